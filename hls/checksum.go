@@ -0,0 +1,45 @@
+package hls
+
+import (
+	"errors"
+	"strings"
+)
+
+const (
+	// DefaultChecksumTag Prefix of the checksum comment line of the chunks (ex: #HASH:sha256=<hex>)
+	DefaultChecksumTag = "#HASH:sha256="
+)
+
+var (
+	// ErrInvalidChecksumTag Checksum tag that is not a single comment line (it must start with #)
+	ErrInvalidChecksumTag = errors.New("checksum tag must be a comment line starting with #")
+
+	// ErrInvalidChecksum Chunk checksum that contains a line break (it would inject playlist lines)
+	ErrInvalidChecksum = errors.New("chunk checksum must not contain line breaks")
+)
+
+// SetChecksumTag Sets the prefix of the comment line written before the #EXTINF of the chunks with a checksum
+// (Chunk.Checksum), ex: #HASH:sha256=. Players and Parse skip it as an unknown tag
+func (p *Hls) SetChecksumTag(checksumTag string) error {
+	if !strings.HasPrefix(checksumTag, "#") || strings.ContainsAny(checksumTag, "\r\n") {
+		return ErrInvalidChecksumTag
+	}
+
+	p.checksumTag = checksumTag
+
+	return nil
+}
+
+// checksumString Returns the checksum comment line of a chunk ("" if none)
+func (p *Hls) checksumString(chunk Chunk) string {
+	if chunk.Checksum == "" {
+		return ""
+	}
+
+	checksumTag := p.checksumTag
+	if checksumTag == "" {
+		checksumTag = DefaultChecksumTag
+	}
+
+	return checksumTag + chunk.Checksum + "\n"
+}
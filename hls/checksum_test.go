@@ -0,0 +1,62 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHlsChecksum(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, Checksum: "0a1b2c"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+
+	xpectedChunk := "#HASH:sha256=0a1b2c\n#EXTINF:4.00000000,\nchunk_00000.ts\n#EXTINF:4.00000000,\nchunk_00001.ts\n"
+	if !strings.HasSuffix(manifestStr, xpectedChunk) {
+		t.Errorf("Checksum is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+
+	// Skipped as an unknown tag
+	parsed, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+	if len(parsed.chunks) != 2 || parsed.chunks[0].Checksum != "" {
+		t.Errorf("Parsed chunks are not correct, got %v", parsed.chunks)
+	}
+	if xpectedManifest := strings.Replace(manifestStr, "#HASH:sha256=0a1b2c\n", "", 1); parsed.String() != xpectedManifest {
+		t.Errorf("Round trip is not correct, got %s, want %s", parsed.String(), xpectedManifest)
+	}
+}
+
+func TestHlsChecksumLineBreak(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+
+	for _, checksum := range []string{"0a1b\n#EXT-X-ENDLIST", "0a1b\r"} {
+		if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, Checksum: checksum}, false); err != ErrInvalidChecksum {
+			t.Errorf("Error for checksum %q is not correct, got %v, want %v", checksum, err, ErrInvalidChecksum)
+		}
+	}
+	if len(h.chunks) != 0 {
+		t.Errorf("Number of chunks is not correct, got %d, want %d", len(h.chunks), 0)
+	}
+}
+
+func TestHlsChecksumTag(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, Checksum: "0a1b2c"}, false)
+
+	for _, checksumTag := range []string{"", "HASH:", "#HASH:\n#"} {
+		if err := h.SetChecksumTag(checksumTag); err != ErrInvalidChecksumTag {
+			t.Errorf("Error for checksum tag %q is not correct, got %v, want %v", checksumTag, err, ErrInvalidChecksumTag)
+		}
+	}
+
+	if err := h.SetChecksumTag("#X-MD5:"); err != nil {
+		t.Fatalf("Unexpected error setting the checksum tag, got %v", err)
+	}
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "\n#X-MD5:0a1b2c\n#EXTINF:") {
+		t.Errorf("Checksum with custom tag is not correct, got %s, want %s", manifestStr, "#X-MD5:0a1b2c")
+	}
+}
@@ -0,0 +1,357 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DateRangeDurationToleranceS Tolerance comparing END-DATE with START-DATE + DURATION
+	DateRangeDurationToleranceS = 0.001
+)
+
+var (
+	// ErrDateRangeNoID Date range without ID
+	ErrDateRangeNoID = errors.New("date range ID is required")
+
+	// ErrDateRangeNoStartDate Date range without START-DATE
+	ErrDateRangeNoStartDate = errors.New("date range START-DATE is required")
+
+	// ErrDateRangeEndBeforeStart Date range END-DATE before START-DATE
+	ErrDateRangeEndBeforeStart = errors.New("date range END-DATE is before START-DATE")
+
+	// ErrDateRangeDurationMismatch Date range DURATION does not match END-DATE - START-DATE
+	ErrDateRangeDurationMismatch = errors.New("date range DURATION does not match END-DATE")
+
+	// ErrDateRangeSCTE35CmdWithOutIn Date range with SCTE35-CMD and SCTE35-OUT or SCTE35-IN
+	ErrDateRangeSCTE35CmdWithOutIn = errors.New("date range SCTE35-CMD can not be used with SCTE35-OUT or SCTE35-IN")
+
+	// ErrDateRangeInvalidCue Date range CUE with an unknown value or with PRE and POST
+	ErrDateRangeInvalidCue = errors.New("date range CUE must be a list of ONCE, PRE or POST (PRE and POST are exclusive)")
+
+	// ErrDateRangeInvalidEndOnNext Date range END-ON-NEXT without CLASS or with END-DATE or DURATION
+	ErrDateRangeInvalidEndOnNext = errors.New("date range END-ON-NEXT requires CLASS and can not be used with END-DATE or DURATION")
+
+	// ErrDateRangeInvalidClientAttribute Date range client attribute without X- prefix or with a not supported value type
+	ErrDateRangeInvalidClientAttribute = errors.New("date range client attribute name must start with X- and value must be a string, []byte or number")
+)
+
+// DateRange Date range information (#EXT-X-DATERANGE)
+type DateRange struct {
+	ID        string
+	Class     string
+	StartDate time.Time
+
+	// Cue When the date range triggers: comma separated list of ONCE, PRE, POST (ex: "ONCE,PRE")
+	Cue string
+
+	// EndDate If not zero renders END-DATE
+	EndDate time.Time
+
+	// DurationS If > 0 renders DURATION
+	DurationS float64
+
+	// SCTE35Cmd SCTE-35 splice_info_section of a splice command (ex: time_signal)
+	SCTE35Cmd []byte
+
+	// SCTE35Out SCTE-35 splice_info_section of a splice out
+	SCTE35Out []byte
+
+	// SCTE35In SCTE-35 splice_info_section of a splice in
+	SCTE35In []byte
+
+	// EndOnNext The date range ends at the start of the next one with the same CLASS (END-ON-NEXT=YES)
+	EndOnNext bool
+
+	// ClientAttributes X- attributes: string values are written quoted, []byte as hex and numbers as is
+	ClientAttributes map[string]interface{}
+}
+
+// validCue Returns true if all the CUE values are known, not repeated, and PRE and POST are not used together
+func validCue(cue string) bool {
+	values := make(map[string]bool)
+	for _, value := range strings.Split(cue, ",") {
+		if (value != "ONCE" && value != "PRE" && value != "POST") || values[value] {
+			return false
+		}
+		values[value] = true
+	}
+
+	return !(values["PRE"] && values["POST"])
+}
+
+// validClientAttributeName Returns true if name is X- followed by uppercase letters, digits or -
+func validClientAttributeName(name string) bool {
+	if !strings.HasPrefix(name, "X-") || len(name) == 2 {
+		return false
+	}
+
+	for _, c := range name {
+		if !((c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9') || c == '-') {
+			return false
+		}
+	}
+
+	return true
+}
+
+// clientAttributeString Returns the value of a client attribute as written, "" if the type is not supported
+func clientAttributeString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return "\"" + escapeQuotes(v) + "\""
+	case []byte:
+		if len(v) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("0x%X", v)
+	case int, int32, int64, uint, uint32, uint64:
+		return fmt.Sprintf("%d", v)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+// hasQuote Returns true if a quoted attribute (ID, CLASS or string client attribute) contains a double quote
+func (d *DateRange) hasQuote() bool {
+	values := []string{d.ID, d.Class}
+	for _, value := range d.ClientAttributes {
+		if v, ok := value.(string); ok {
+			values = append(values, v)
+		}
+	}
+
+	for _, value := range values {
+		if strings.Contains(value, "\"") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate Checks the date range attributes consistency
+func (d *DateRange) Validate() error {
+	if d.ID == "" {
+		return ErrDateRangeNoID
+	}
+	if d.StartDate.IsZero() {
+		return ErrDateRangeNoStartDate
+	}
+
+	if d.Cue != "" && !validCue(d.Cue) {
+		return ErrDateRangeInvalidCue
+	}
+
+	for name, value := range d.ClientAttributes {
+		if !validClientAttributeName(name) || clientAttributeString(value) == "" {
+			return ErrDateRangeInvalidClientAttribute
+		}
+	}
+
+	if d.EndOnNext && (d.Class == "" || !d.EndDate.IsZero() || d.DurationS > 0) {
+		return ErrDateRangeInvalidEndOnNext
+	}
+
+	if d.SCTE35Cmd != nil && (d.SCTE35Out != nil || d.SCTE35In != nil) {
+		return ErrDateRangeSCTE35CmdWithOutIn
+	}
+
+	if !d.EndDate.IsZero() {
+		if d.EndDate.Before(d.StartDate) {
+			return ErrDateRangeEndBeforeStart
+		}
+
+		if d.DurationS > 0 && math.Abs(d.EndDate.Sub(d.StartDate).Seconds()-d.DurationS) > DateRangeDurationToleranceS {
+			return ErrDateRangeDurationMismatch
+		}
+	}
+
+	return nil
+}
+
+// String write date range info (#EXT-X-DATERANGE). Attributes are always written in this order: ID, CLASS, START-DATE, CUE,
+// END-DATE, DURATION, SCTE35-CMD, SCTE35-OUT, SCTE35-IN, END-ON-NEXT, then the client attributes sorted by name
+func (d *DateRange) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXT-X-DATERANGE:ID=\"" + escapeQuotes(d.ID) + "\"")
+
+	if d.Class != "" {
+		buffer.WriteString(",CLASS=\"" + escapeQuotes(d.Class) + "\"")
+	}
+	buffer.WriteString(",START-DATE=\"" + d.StartDate.Format(ProgramDateTimeFormat) + "\"")
+	if d.Cue != "" {
+		buffer.WriteString(",CUE=\"" + d.Cue + "\"")
+	}
+	if !d.EndDate.IsZero() {
+		buffer.WriteString(",END-DATE=\"" + d.EndDate.Format(ProgramDateTimeFormat) + "\"")
+	}
+	if d.DurationS > 0 {
+		buffer.WriteString(",DURATION=" + fmt.Sprintf("%.3f", d.DurationS))
+	}
+	if d.SCTE35Cmd != nil {
+		buffer.WriteString(",SCTE35-CMD=" + fmt.Sprintf("0x%X", d.SCTE35Cmd))
+	}
+	if d.SCTE35Out != nil {
+		buffer.WriteString(",SCTE35-OUT=" + fmt.Sprintf("0x%X", d.SCTE35Out))
+	}
+	if d.SCTE35In != nil {
+		buffer.WriteString(",SCTE35-IN=" + fmt.Sprintf("0x%X", d.SCTE35In))
+	}
+	if d.EndOnNext {
+		buffer.WriteString(",END-ON-NEXT=YES")
+	}
+
+	names := make([]string, 0, len(d.ClientAttributes))
+	for name := range d.ClientAttributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		buffer.WriteString("," + name + "=" + clientAttributeString(d.ClientAttributes[name]))
+	}
+	buffer.WriteString("\n")
+
+	return buffer.String()
+}
+
+// AddDateRange Adds a date range to the chunklist after validating it.
+// Date ranges are kept sorted by StartDate. In LiveWindow mode they are removed once they end before the first
+// chunk of the window (see pruneDateRanges)
+func (p *Hls) AddDateRange(dateRange DateRange) error {
+	if err := dateRange.Validate(); err != nil {
+		return err
+	}
+	if p.rejectQuotes && dateRange.hasQuote() {
+		return ErrQuotedAttribute
+	}
+
+	p.dateRanges = append(p.dateRanges, dateRange)
+	sort.SliceStable(p.dateRanges, func(i, j int) bool {
+		return p.dateRanges[i].StartDate.Before(p.dateRanges[j].StartDate)
+	})
+
+	return nil
+}
+
+// ResolvedDateRangeDurations Returns the durations (by ID) of the END-ON-NEXT date ranges closed by the next
+// date range with the same CLASS. The ones not closed yet are not returned
+func (p *Hls) ResolvedDateRangeDurations() map[string]float64 {
+	ret := make(map[string]float64)
+
+	for i, dateRange := range p.dateRanges {
+		if !dateRange.EndOnNext {
+			continue
+		}
+
+		for _, next := range p.dateRanges[i+1:] {
+			if next.Class == dateRange.Class {
+				ret[dateRange.ID] = next.StartDate.Sub(dateRange.StartDate).Seconds()
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// windowStartTime Returns the program date time of the first chunk, extrapolated from the first chunk with one
+// (zero if no chunk has a program date time)
+func (p *Hls) windowStartTime() time.Time {
+	var offset durationAccumulator
+	for _, chunk := range p.chunks {
+		if !chunk.ProgramDateTime.IsZero() {
+			return chunk.ProgramDateTime.Add(-time.Duration(offset.Sum() * float64(time.Second)))
+		}
+		offset.Add(chunk.DurationS)
+	}
+
+	return time.Time{}
+}
+
+// pruneDateRanges Removes the date ranges that end before the first chunk of the window. The end is END-DATE,
+// START-DATE + DURATION, or the start of the next date range of the same CLASS for END-ON-NEXT; without any,
+// the date range ends at its start. Nothing is removed if the chunks have no program date time
+func (p *Hls) pruneDateRanges() {
+	windowStart := p.windowStartTime()
+	if windowStart.IsZero() || len(p.dateRanges) == 0 {
+		return
+	}
+
+	resolvedDurations := p.ResolvedDateRangeDurations()
+	kept := p.dateRanges[:0]
+	for _, dateRange := range p.dateRanges {
+		end := dateRange.EndDate
+		if end.IsZero() {
+			durationS := dateRange.DurationS
+			if resolvedDurationS, found := resolvedDurations[dateRange.ID]; found && dateRange.EndOnNext {
+				durationS = resolvedDurationS
+			} else if dateRange.EndOnNext {
+				// Not closed yet
+				kept = append(kept, dateRange)
+				continue
+			}
+			end = dateRange.StartDate.Add(time.Duration(durationS * float64(time.Second)))
+		}
+
+		if end.Before(windowStart) {
+			p.log.Debug("Date range ", dateRange.ID, " ended before the window, removing it")
+			continue
+		}
+		kept = append(kept, dateRange)
+	}
+	p.dateRanges = kept
+}
+
+// dateRangeChunkIndex Returns the index of the chunk that contains the date range start, using the chunks
+// program date time (extrapolated from the durations of the chunks without it). -1 if it can not be positioned
+func (p *Hls) dateRangeChunkIndex(dateRange DateRange) int {
+	ret := -1
+
+	chunkStart := time.Time{}
+	for i, chunk := range p.chunks {
+		if !chunk.ProgramDateTime.IsZero() {
+			chunkStart = chunk.ProgramDateTime
+		}
+		if chunkStart.IsZero() {
+			continue
+		}
+		if chunkStart.After(dateRange.StartDate) {
+			break
+		}
+
+		ret = i
+		chunkStart = chunkStart.Add(time.Duration(chunk.DurationS * float64(time.Second)))
+	}
+
+	return ret
+}
+
+// dateRangesString Returns the date ranges to render before the chunk chunkIndex.
+// The ones that start before the 1st rendered chunk (headIndex) are rendered before it
+func (p *Hls) dateRangesString(ctx renderContext, chunkIndex int, headIndex int) string {
+	var buffer bytes.Buffer
+
+	for i, dateRange := range p.dateRanges {
+		index := ctx.dateRangeIndexes[i]
+		if index < headIndex {
+			index = headIndex
+		}
+		if index == chunkIndex {
+			buffer.WriteString(dateRange.String())
+		}
+	}
+
+	return buffer.String()
+}
@@ -0,0 +1,323 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDateRangeEndDateOnly(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	err := h.AddDateRange(DateRange{ID: "ad1", Class: "com.example.ad", StartDate: start, EndDate: start.Add(30 * time.Second)})
+	if err != nil {
+		t.Fatalf("Unexpected error adding date range: %v", err)
+	}
+
+	xpectedTag := "#EXT-X-DATERANGE:ID=\"ad1\",CLASS=\"com.example.ad\",START-DATE=\"2020-01-01T10:00:00.000Z\",END-DATE=\"2020-01-01T10:00:30.000Z\"\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTag) {
+		t.Errorf("Date range is not correct, got %s, want %s", manifestStr, xpectedTag)
+	}
+}
+
+func TestDateRangeDurationOnly(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, DurationS: 30.0})
+	if err != nil {
+		t.Fatalf("Unexpected error adding date range: %v", err)
+	}
+
+	xpectedTag := "#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2020-01-01T10:00:00.000Z\",DURATION=30.000\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTag) {
+		t.Errorf("Date range is not correct, got %s, want %s", manifestStr, xpectedTag)
+	}
+}
+
+func TestDateRangeEndDateAndDuration(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, EndDate: start.Add(30 * time.Second), DurationS: 30.0})
+	if err != nil {
+		t.Fatalf("Unexpected error adding date range: %v", err)
+	}
+
+	xpectedTag := "#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2020-01-01T10:00:00.000Z\",END-DATE=\"2020-01-01T10:00:30.000Z\",DURATION=30.000\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTag) {
+		t.Errorf("Date range is not correct, got %s, want %s", manifestStr, xpectedTag)
+	}
+}
+
+func TestDateRangeInconsistent(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+
+	if err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, EndDate: start.Add(-time.Second)}); err != ErrDateRangeEndBeforeStart {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrDateRangeEndBeforeStart)
+	}
+	if err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, EndDate: start.Add(30 * time.Second), DurationS: 20.0}); err != ErrDateRangeDurationMismatch {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrDateRangeDurationMismatch)
+	}
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-DATERANGE") {
+		t.Errorf("Invalid date ranges should not be added, got %s", manifestStr)
+	}
+}
+
+func TestDateRangeSCTE35Cmd(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	err := h.AddDateRange(DateRange{ID: "splice1", StartDate: start, SCTE35Cmd: []byte{0xfc, 0x30, 0x11, 0x06}})
+	if err != nil {
+		t.Fatalf("Unexpected error adding date range: %v", err)
+	}
+
+	xpectedTag := "#EXT-X-DATERANGE:ID=\"splice1\",START-DATE=\"2020-01-01T10:00:00.000Z\",SCTE35-CMD=0xFC301106\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTag) {
+		t.Errorf("Date range is not correct, got %s, want %s", manifestStr, xpectedTag)
+	}
+}
+
+func TestDateRangeSCTE35CmdWithOut(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	err := h.AddDateRange(DateRange{ID: "splice1", StartDate: start, SCTE35Cmd: []byte{0xfc, 0x30}, SCTE35Out: []byte{0xfc, 0x31}})
+	if err != ErrDateRangeSCTE35CmdWithOutIn {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrDateRangeSCTE35CmdWithOutIn)
+	}
+	if len(h.dateRanges) != 0 {
+		t.Errorf("Invalid date range should not be added, got %d date ranges", len(h.dateRanges))
+	}
+}
+
+func TestDateRangeCue(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, cue := range []string{"PRE", "POST", "ONCE,PRE"} {
+		h := newTestHls(LiveWindow, 3)
+		if err := h.AddDateRange(DateRange{ID: "ad1", Class: "com.apple.hls.interstitial", StartDate: start, Cue: cue}); err != nil {
+			t.Fatalf("Unexpected error adding date range with CUE %s: %v", cue, err)
+		}
+
+		xpectedTag := "#EXT-X-DATERANGE:ID=\"ad1\",CLASS=\"com.apple.hls.interstitial\",START-DATE=\"2020-01-01T10:00:00.000Z\",CUE=\"" + cue + "\"\n"
+		if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTag) {
+			t.Errorf("Date range is not correct, got %s, want %s", manifestStr, xpectedTag)
+		}
+	}
+
+	for _, cue := range []string{"PRE,POST", "LATER", "ONCE,ONCE", "once"} {
+		h := newTestHls(LiveWindow, 3)
+		if err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, Cue: cue}); err != ErrDateRangeInvalidCue {
+			t.Errorf("Error for CUE %s is not correct, got %v, want %v", cue, err, ErrDateRangeInvalidCue)
+		}
+	}
+}
+
+func TestDateRangeClientAttributes(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, ClientAttributes: map[string]interface{}{
+		"X-AD-ID":     "ad-1234",
+		"X-PAYLOAD":   []byte{0x01, 0xab},
+		"X-POSITION":  2,
+		"X-VOLUME":    0.75,
+		"X-TIMESCALE": 90000.0,
+		"X-BIG-COUNT": int64(1) << 40,
+	}})
+	if err != nil {
+		t.Fatalf("Unexpected error adding date range: %v", err)
+	}
+
+	xpectedTag := "#EXT-X-DATERANGE:ID=\"ad1\",START-DATE=\"2020-01-01T10:00:00.000Z\",X-AD-ID=\"ad-1234\",X-BIG-COUNT=1099511627776,X-PAYLOAD=0x01AB,X-POSITION=2,X-TIMESCALE=90000,X-VOLUME=0.75\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTag) {
+		t.Errorf("Date range is not correct, got %s, want %s", manifestStr, xpectedTag)
+	}
+}
+
+func TestDateRangeInvalidClientAttributes(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	for _, attributes := range []map[string]interface{}{
+		{"AD-ID": "ad-1234"},
+		{"X-ad-id": "ad-1234"},
+		{"X-AD-ID": true},
+		{"X-PAYLOAD": []byte{}},
+	} {
+		h := newTestHls(LiveWindow, 3)
+		if err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, ClientAttributes: attributes}); err != ErrDateRangeInvalidClientAttribute {
+			t.Errorf("Error for %v is not correct, got %v, want %v", attributes, err, ErrDateRangeInvalidClientAttribute)
+		}
+	}
+}
+
+func TestDateRangeSortedAndPositioned(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveEvent, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, ProgramDateTime: start}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+
+	for _, dateRange := range []DateRange{
+		{ID: "c", StartDate: start.Add(9 * time.Second), DurationS: 1.0},
+		{ID: "a", StartDate: start.Add(-time.Second), DurationS: 1.0},
+		{ID: "b", StartDate: start.Add(4 * time.Second), DurationS: 1.0},
+	} {
+		if err := h.AddDateRange(dateRange); err != nil {
+			t.Fatalf("Unexpected error adding date range: %v", err)
+		}
+	}
+
+	manifestStr := h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-TARGETDURATION:4
+#EXT-X-DATERANGE:ID="a",START-DATE="2020-01-01T09:59:59.000Z",DURATION=1.000
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00.000Z
+#EXTINF:4.00000000,
+chunk_00000.ts
+#EXT-X-DATERANGE:ID="b",START-DATE="2020-01-01T10:00:04.000Z",DURATION=1.000
+#EXTINF:4.00000000,
+chunk_00001.ts
+#EXT-X-DATERANGE:ID="c",START-DATE="2020-01-01T10:00:09.000Z",DURATION=1.000
+#EXTINF:4.00000000,
+chunk_00002.ts
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestDateRangeSortedWithoutProgramDateTime(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddDateRange(DateRange{ID: "b", StartDate: start.Add(time.Minute)})
+	h.AddDateRange(DateRange{ID: "a", StartDate: start})
+
+	manifestStr := h.String()
+	if a, b := strings.Index(manifestStr, "ID=\"a\""), strings.Index(manifestStr, "ID=\"b\""); a < 0 || b < 0 || a > b {
+		t.Errorf("Date ranges order is not correct, got %s, want a before b", manifestStr)
+	}
+}
+
+func TestDateRangeGolden(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	newGoldenHls := func() Hls {
+		h := newTestHls(LiveWindow, 3)
+		h.SetHlsVersion(HlsVersionKeyFormat)
+		h.SetKeys(Key{Method: "SAMPLE-AES", URI: "skd://key1", IV: "0x0123456789abcdef0123456789abcdef", KeyFormat: KeyFormatFairPlay, KeyFormatVersions: "1"})
+		h.AddDateRange(DateRange{ID: "ad1", Class: "com.example.ad", StartDate: start, Cue: "ONCE", EndDate: start.Add(30 * time.Second), DurationS: 30.0, SCTE35Out: []byte{0xFC, 0x30}, ClientAttributes: map[string]interface{}{"X-Z": 1, "X-A": "a", "X-M": 1.5, "X-B": []byte{0xAB}}})
+		h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, ProgramDateTime: start}, false)
+		return h
+	}
+
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:5
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-TARGETDURATION:4
+#EXT-X-DATERANGE:ID="ad1",CLASS="com.example.ad",START-DATE="2020-01-01T10:00:00.000Z",CUE="ONCE",END-DATE="2020-01-01T10:00:30.000Z",DURATION=30.000,SCTE35-OUT=0xFC30,X-A="a",X-B=0xAB,X-M=1.5,X-Z=1
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key1",IV=0x0123456789abcdef0123456789abcdef,KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00.000Z
+#EXTINF:4.00000000,
+chunk_00000.ts
+`
+	for i := 0; i < 10; i++ {
+		h := newGoldenHls()
+		if manifestStr := h.String(); manifestStr != xpectedmanifestStr {
+			t.Fatalf("Chunklist is not correct (run %d), got %s, want %s", i, manifestStr, xpectedmanifestStr)
+		}
+	}
+}
+
+func TestDateRangeEndOnNext(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	if err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, EndOnNext: true}); err != ErrDateRangeInvalidEndOnNext {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrDateRangeInvalidEndOnNext)
+	}
+	if err := h.AddDateRange(DateRange{ID: "ad1", Class: "com.example.ad", StartDate: start, DurationS: 30.0, EndOnNext: true}); err != ErrDateRangeInvalidEndOnNext {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrDateRangeInvalidEndOnNext)
+	}
+
+	for _, dateRange := range []DateRange{
+		{ID: "ad3", Class: "com.example.ad", StartDate: start.Add(75 * time.Second), EndOnNext: true},
+		{ID: "ad1", Class: "com.example.ad", StartDate: start, EndOnNext: true},
+		{ID: "other", Class: "com.example.other", StartDate: start.Add(10 * time.Second), EndOnNext: true},
+		{ID: "ad2", Class: "com.example.ad", StartDate: start.Add(30 * time.Second), EndOnNext: true},
+	} {
+		if err := h.AddDateRange(dateRange); err != nil {
+			t.Fatalf("Unexpected error adding date range: %v", err)
+		}
+	}
+
+	xpectedTag := "#EXT-X-DATERANGE:ID=\"ad1\",CLASS=\"com.example.ad\",START-DATE=\"2020-01-01T10:00:00.000Z\",END-ON-NEXT=YES\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTag) {
+		t.Errorf("Date range is not correct, got %s, want %s", manifestStr, xpectedTag)
+	}
+
+	// ad3 and other are not closed yet
+	xpectedDurations := map[string]float64{"ad1": 30.0, "ad2": 45.0}
+	durations := h.ResolvedDateRangeDurations()
+	if len(durations) != len(xpectedDurations) {
+		t.Errorf("Resolved durations are not correct, got %v, want %v", durations, xpectedDurations)
+	}
+	for id, xpectedDuration := range xpectedDurations {
+		if durations[id] != xpectedDuration {
+			t.Errorf("Duration of %s is not correct, got %f, want %f", id, durations[id], xpectedDuration)
+		}
+	}
+}
+
+func TestHlsDateRangesPrunedOnEviction(t *testing.T) {
+	start := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	h.AddDateRange(DateRange{ID: "ended", StartDate: start, DurationS: 4.0})
+	h.AddDateRange(DateRange{ID: "instant", StartDate: start.Add(2 * time.Second)})
+	h.AddDateRange(DateRange{ID: "long", StartDate: start, EndDate: start.Add(time.Minute)})
+	h.AddDateRange(DateRange{ID: "open", Class: "com.example.ad", StartDate: start.Add(time.Second), EndOnNext: true})
+
+	for i := 0; i < 6; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0, ProgramDateTime: start.Add(time.Duration(i*4) * time.Second)}, false)
+	}
+
+	// The window starts at 10:00:12
+	xpectedIDs := []string{"long", "open"}
+	ids := make([]string, 0)
+	for _, dateRange := range h.dateRanges {
+		ids = append(ids, dateRange.ID)
+	}
+	if fmt.Sprint(ids) != fmt.Sprint(xpectedIDs) {
+		t.Errorf("Date ranges are not correct, got %v, want %v", ids, xpectedIDs)
+	}
+	if manifestStr := h.String(); strings.Contains(manifestStr, "ID=\"ended\"") || strings.Contains(manifestStr, "ID=\"instant\"") {
+		t.Errorf("Ended date ranges should not be rendered, got %s", manifestStr)
+	}
+
+	// Once closed by the next one of its class, the END-ON-NEXT date range ends too
+	h.AddDateRange(DateRange{ID: "next", Class: "com.example.ad", StartDate: start.Add(13 * time.Second), EndOnNext: true})
+	h.AddChunk(Chunk{FileName: "results/chunk_00006.ts", DurationS: 4.0, ProgramDateTime: start.Add(24 * time.Second)}, false)
+	xpectedIDs = []string{"long", "next"}
+	ids = ids[:0]
+	for _, dateRange := range h.dateRanges {
+		ids = append(ids, dateRange.ID)
+	}
+	if fmt.Sprint(ids) != fmt.Sprint(xpectedIDs) {
+		t.Errorf("Date ranges are not correct, got %v, want %v", ids, xpectedIDs)
+	}
+}
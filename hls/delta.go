@@ -0,0 +1,31 @@
+package hls
+
+// SetCanSkipUntil Enables delta updates (#EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL), 0 disables them.
+// The spec requires at least 6 target durations
+func (p *Hls) SetCanSkipUntil(canSkipUntilS float64) {
+	p.canSkipUntilS = canSkipUntilS
+}
+
+// skippedChunks Returns the number of chunks before the skip boundary: the oldest chunks that can be
+// removed keeping at least canSkipUntilS seconds of chunks at the end of the chunklist
+func (p *Hls) skippedChunks() int {
+	if p.canSkipUntilS <= 0 {
+		return 0
+	}
+
+	var keptDurS durationAccumulator
+	for i := len(p.chunks) - 1; i >= 0; i-- {
+		keptDurS.Add(p.chunks[i].DurationS)
+		if keptDurS.Sum() >= p.canSkipUntilS {
+			return i
+		}
+	}
+
+	return 0
+}
+
+// RenderDelta Returns the delta update of the chunklist (chunks before the skip boundary replaced by #EXT-X-SKIP).
+// Chunks are not evicted, the media sequence is the same as in the full chunklist
+func (p *Hls) RenderDelta() string {
+	return p.render(p.newRenderContext(p.EffectiveVersion()), p.skippedChunks())
+}
@@ -0,0 +1,54 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestHlsRenderDeltaSkippedSegments(t *testing.T) {
+	h := newTestHls(LiveWindow, 10)
+	h.SetCanSkipUntil(12.0)
+	for i := 0; i < 8; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, false)
+	}
+	// Evicts 2 chunks
+	for i := 8; i < 12; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, false)
+	}
+
+	fullStr := h.String()
+	deltaStr := h.RenderDelta()
+
+	fullChunks := strings.Count(fullStr, "#EXTINF:")
+	deltaChunks := strings.Count(deltaStr, "#EXTINF:")
+
+	xpectedSkipped := 7
+	xpectedSkipTag := fmt.Sprintf("#EXT-X-SKIP:SKIPPED-SEGMENTS=%d\n", xpectedSkipped)
+	if !strings.Contains(deltaStr, xpectedSkipTag) {
+		t.Errorf("Skip tag is not correct, got %s, want %s", deltaStr, xpectedSkipTag)
+	}
+	if xpectedSkipped+deltaChunks != fullChunks {
+		t.Errorf("Skipped + present chunks is not correct, got %d + %d, want %d", xpectedSkipped, deltaChunks, fullChunks)
+	}
+	if !strings.Contains(deltaStr, "#EXT-X-MEDIA-SEQUENCE:2\n") || !strings.Contains(fullStr, "#EXT-X-MEDIA-SEQUENCE:2\n") {
+		t.Errorf("Media sequence should not change skipping, got %s", deltaStr)
+	}
+	if !strings.HasSuffix(fullStr, deltaStr[strings.Index(deltaStr, xpectedSkipTag)+len(xpectedSkipTag):]) {
+		t.Errorf("Delta chunks should be the last ones of the full chunklist, got %s", deltaStr)
+	}
+	if len(h.chunks) != 10 {
+		t.Errorf("Delta render should not evict chunks, got %d, want %d", len(h.chunks), 10)
+	}
+}
+
+func TestHlsRenderDeltaNothingToSkip(t *testing.T) {
+	h := newTestHls(LiveWindow, 10)
+	h.SetCanSkipUntil(24.0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	if deltaStr := h.RenderDelta(); deltaStr != h.String() || strings.Contains(deltaStr, "#EXT-X-SKIP") {
+		t.Errorf("Delta render should be the full chunklist, got %s", deltaStr)
+	}
+}
@@ -0,0 +1,134 @@
+package hls
+
+import (
+	"os"
+	"sync"
+)
+
+// WindowCombinators indicates how the sliding window size and duration are combined to evict chunks
+type WindowCombinators int
+
+const (
+	// WindowCombinatorAnd Evicts a chunk when the window exceeds both the size and the duration
+	// (keeps at least the size in chunks and the longest window within the duration)
+	WindowCombinatorAnd WindowCombinators = iota
+
+	// WindowCombinatorOr Evicts a chunk when the window exceeds the size or the duration
+	// (keeps at most the size in chunks and the duration)
+	WindowCombinatorOr
+)
+
+// SetEvictionCallback Sets a function called for each chunk evicted from the window, err is the
+// result of deleting its file (nil if not deleted). With async deletes it is called from several goroutines
+func (p *Hls) SetEvictionCallback(onEvict func(chunk Chunk, err error)) {
+	p.onEvict = onEvict
+}
+
+// SetEvictionPolicy Sets a function that decides how many of the oldest chunks are evicted after each AddChunk
+// in LiveWindow mode, instead of keeping the sliding window size (ex: keep the chunks from the last keyframe aligned
+// boundary). chunks must not be modified. The result is limited so the last added chunk is always kept. nil restores the default
+func (p *Hls) SetEvictionPolicy(evictionPolicy func(chunks []Chunk) int) {
+	p.evictionPolicy = evictionPolicy
+}
+
+// SetSlidingWindowDuration Limits the LiveWindow chunklist to durationS seconds besides the sliding window size,
+// combined by combinator (0 disables it). Ignored if an eviction policy is set
+func (p *Hls) SetSlidingWindowDuration(durationS float64, combinator WindowCombinators) {
+	p.windowDurationS = durationS
+	p.windowCombinator = combinator
+}
+
+// durationEvictCount Returns the number of the oldest chunks to evict so the window lasts at most windowDurationS
+func (p *Hls) durationEvictCount() int {
+	remainingS := p.TotalDuration()
+
+	ret := 0
+	for ret < len(p.chunks) && remainingS > p.windowDurationS {
+		remainingS -= p.chunks[ret].DurationS
+		ret++
+	}
+
+	return ret
+}
+
+// evictCount Returns the number of chunks to evict from the window
+func (p *Hls) evictCount() int {
+	ret := len(p.chunks) - p.slidingWindowSize
+	if p.windowDurationS > 0 {
+		durationRet := p.durationEvictCount()
+		if p.windowCombinator == WindowCombinatorAnd && durationRet < ret {
+			ret = durationRet
+		} else if p.windowCombinator == WindowCombinatorOr && durationRet > ret {
+			ret = durationRet
+		}
+	}
+	if p.evictionPolicy != nil {
+		ret = p.evictionPolicy(p.chunks)
+	}
+
+	if ret > len(p.chunks)-1 {
+		ret = len(p.chunks) - 1
+	}
+	if ret < 0 {
+		ret = 0
+	}
+
+	return ret
+}
+
+// SetDeleteEvicted Deletes the files of the chunks evicted from the window.
+// If workers > 0 the deletes are done asynchronously by up to workers goroutines, see WaitEvictions
+func (p *Hls) SetDeleteEvicted(deleteEvicted bool, workers int) {
+	p.deleteEvicted = deleteEvicted
+	p.evictionWorkers = nil
+	if workers > 0 {
+		p.evictionWorkers = make(chan struct{}, workers)
+	}
+	if p.evictionWait == nil {
+		p.evictionWait = &sync.WaitGroup{}
+	}
+}
+
+// WaitEvictions Waits until all the async deletes of evicted chunks are done
+func (p *Hls) WaitEvictions() {
+	if p.evictionWait != nil {
+		p.evictionWait.Wait()
+	}
+}
+
+// evicted Handles a chunk removed from the window
+func (p *Hls) evicted(chunk Chunk) {
+	if !p.deleteEvicted || chunk.InlineData != nil {
+		if p.onEvict != nil {
+			p.onEvict(chunk, nil)
+		}
+		return
+	}
+
+	if p.evictionWorkers == nil {
+		p.deleteEvictedChunk(chunk)
+		return
+	}
+
+	p.evictionWait.Add(1)
+	go func(workers chan struct{}) {
+		workers <- struct{}{}
+		defer func() {
+			<-workers
+			p.evictionWait.Done()
+		}()
+
+		p.deleteEvictedChunk(chunk)
+	}(p.evictionWorkers)
+}
+
+func (p *Hls) deleteEvictedChunk(chunk Chunk) {
+	err := os.Remove(chunk.FileName)
+	if err != nil {
+		p.log.Warn("Error deleting evicted chunk ", chunk.FileName, ". Error: ", err)
+	}
+
+	if p.onEvict != nil {
+		p.onEvict(chunk, err)
+	}
+}
@@ -0,0 +1,189 @@
+package hls
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestHlsDeleteEvictedAsync(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var mutex sync.Mutex
+	evictedErrors := make(map[string]error)
+
+	h := newTestHls(LiveWindow, 2)
+	h.SetDeleteEvicted(true, 2)
+	h.SetEvictionCallback(func(chunk Chunk, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		evictedErrors[chunk.FileName] = err
+	})
+
+	fileNames := make([]string, 0)
+	for i := 0; i < 8; i++ {
+		fileName := path.Join(dir, fmt.Sprintf("chunk_%05d.ts", i))
+		// Chunk 3 is missing on disk
+		if i != 3 {
+			if err := ioutil.WriteFile(fileName, []byte("data"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		fileNames = append(fileNames, fileName)
+		h.AddChunk(Chunk{FileName: fileName, DurationS: 4.0}, false)
+	}
+	h.WaitEvictions()
+
+	xpectedEvicted := 6
+	if len(evictedErrors) != xpectedEvicted {
+		t.Errorf("Number of evicted chunks is not correct, got %d, want %d", len(evictedErrors), xpectedEvicted)
+	}
+	for i, fileName := range fileNames {
+		_, statErr := os.Stat(fileName)
+		if i < xpectedEvicted && !os.IsNotExist(statErr) {
+			t.Errorf("Evicted chunk %s should be deleted", fileName)
+		}
+		if i >= xpectedEvicted && statErr != nil {
+			t.Errorf("Chunk %s in the window should not be deleted, got %v", fileName, statErr)
+		}
+	}
+
+	if err := evictedErrors[fileNames[3]]; err == nil {
+		t.Errorf("Expected an error deleting the missing chunk %s", fileNames[3])
+	}
+	if err := evictedErrors[fileNames[0]]; err != nil {
+		t.Errorf("Unexpected error deleting %s, got %v", fileNames[0], err)
+	}
+}
+
+func TestHlsEvictionPolicy(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+
+	// Keeps the chunks from the 2nd newest independent chunk (keyframe aligned boundary)
+	h.SetEvictionPolicy(func(chunks []Chunk) int {
+		found := 0
+		for i := len(chunks) - 1; i >= 0; i-- {
+			if chunks[i].SizeBytes == 1 {
+				found++
+				if found == 2 {
+					return i
+				}
+			}
+		}
+		return 0
+	})
+
+	evicted := make([]string, 0)
+	h.SetEvictionCallback(func(chunk Chunk, err error) {
+		evicted = append(evicted, chunk.FileName)
+	})
+
+	for i := 0; i < 8; i++ {
+		// Independent chunk every 3 chunks
+		sizeBytes := int64(0)
+		if i%3 == 0 {
+			sizeBytes = 1
+		}
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0, SizeBytes: sizeBytes}, false)
+	}
+
+	// Independent chunks 0, 3, 6: keeps from chunk 3, more than the sliding window size
+	xpectedChunks := 5
+	if len(h.chunks) != xpectedChunks {
+		t.Errorf("Number of chunks is not correct, got %d, want %d", len(h.chunks), xpectedChunks)
+	}
+	if h.chunks[0].FileName != "results/chunk_00003.ts" {
+		t.Errorf("First chunk is not correct, got %s, want %s", h.chunks[0].FileName, "results/chunk_00003.ts")
+	}
+	if h.mseq != 3 || len(evicted) != 3 {
+		t.Errorf("Media sequence is not correct, got %d (%d evicted), want %d", h.mseq, len(evicted), 3)
+	}
+
+	// An eviction count too high keeps the last chunk
+	h.SetEvictionPolicy(func(chunks []Chunk) int {
+		return 100
+	})
+	h.AddChunk(Chunk{FileName: "results/chunk_00008.ts", DurationS: 4.0}, false)
+	if len(h.chunks) != 1 || h.chunks[0].FileName != "results/chunk_00008.ts" {
+		t.Errorf("Chunks are not correct, got %v, want only the last one", h.chunks)
+	}
+}
+
+func TestHlsSlidingWindowDuration(t *testing.T) {
+	durations := []float64{2.0, 2.0, 2.0, 2.0, 6.0, 6.0, 1.0}
+
+	xpectedWindows := map[WindowCombinators][]string{
+		WindowCombinatorAnd: {"results/chunk_00004.ts", "results/chunk_00005.ts", "results/chunk_00006.ts"},
+		WindowCombinatorOr:  {"results/chunk_00005.ts", "results/chunk_00006.ts"},
+	}
+	xpectedMseqs := map[WindowCombinators]int64{WindowCombinatorAnd: 4, WindowCombinatorOr: 5}
+
+	for combinator, xpectedWindow := range xpectedWindows {
+		h := newTestHls(LiveWindow, 3)
+		h.SetSlidingWindowDuration(10.0, combinator)
+
+		for i, durationS := range durations {
+			h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: durationS, IsDisco: i == 2}, false)
+		}
+
+		fileNames := make([]string, 0)
+		for _, chunk := range h.chunks {
+			fileNames = append(fileNames, chunk.FileName)
+		}
+		if fmt.Sprint(fileNames) != fmt.Sprint(xpectedWindow) {
+			t.Errorf("Window with combinator %d is not correct, got %v, want %v", combinator, fileNames, xpectedWindow)
+		}
+		if h.mseq != xpectedMseqs[combinator] || h.dseq != 1 {
+			t.Errorf("Sequences with combinator %d are not correct, got %d/%d, want %d/%d", combinator, h.mseq, h.dseq, xpectedMseqs[combinator], 1)
+		}
+	}
+}
+
+func TestHlsAllDiscoWindow(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+
+	xpectedDseqs := []int64{0, 0, 0, 1, 2, 3}
+	for i := 0; i < 6; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0, IsDisco: true}, false)
+		if h.dseq != xpectedDseqs[i] {
+			t.Errorf("Discontinuity sequence after chunk %d is not correct, got %d, want %d", i, h.dseq, xpectedDseqs[i])
+		}
+	}
+
+	// Each chunk keeps its discontinuity, the head has a single one
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:3
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-DISCONTINUITY
+#EXTINF:4.00000000,
+chunk_00003.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:4.00000000,
+chunk_00004.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:4.00000000,
+chunk_00005.ts
+`
+	if manifestStr := h.String(); manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+
+	// A chunk without discontinuity at the head renders none
+	h.AddChunk(Chunk{FileName: "results/chunk_00006.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00007.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00008.ts", DurationS: 4.0}, false)
+	xpectedHead := "#EXT-X-DISCONTINUITY-SEQUENCE:6\n#EXT-X-TARGETDURATION:4\n#EXTINF:4.00000000,\nchunk_00006.ts\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedHead) || strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY\n") {
+		t.Errorf("Chunklist head is not correct, got %s, want %s", manifestStr, xpectedHead)
+	}
+}
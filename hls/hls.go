@@ -2,14 +2,23 @@ package hls
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
@@ -43,6 +52,107 @@ const (
 
 	// HlsOutputModeHTTP chunks to chunked streaming server
 	HlsOutputModeHTTP
+
+	// HlsOutputModeWebDAV Uploads the chunklist to a WebDAV server (PUT)
+	HlsOutputModeWebDAV
+
+	// HlsOutputModeWriter Writes the chunklist to a writer set by SetOutputWriter (ex: os.Stdout for debugging)
+	HlsOutputModeWriter
+)
+
+// TransferModes indicates how the chunklist body is sent in HTTP output mode
+type TransferModes int
+
+const (
+	// TransferModeContentLength Sends the chunklist with a fixed Content-Length
+	TransferModeContentLength TransferModes = iota
+
+	// TransferModeChunked Sends the chunklist with chunked transfer encoding (LL-HLS growing pushes)
+	TransferModeChunked
+)
+
+// URICaseModes indicates the case transform applied to the chunk URIs
+type URICaseModes int
+
+const (
+	// URICasePreserve Writes the URIs as the filenames
+	URICasePreserve URICaseModes = iota
+
+	// URICaseLower Writes the URIs in lowercase
+	URICaseLower
+
+	// URICaseUpper Writes the URIs in uppercase
+	URICaseUpper
+)
+
+// ParentURIModes indicates how the relative URIs that go up the chunklist directory (..) are handled
+type ParentURIModes int
+
+const (
+	// ParentURIAllow Writes them as is (ex: ../init.mp4)
+	ParentURIAllow ParentURIModes = iota
+
+	// ParentURIAbsolute Writes them as absolute URLs (HTTP scheme, host and path, see SetAbsoluteURIs)
+	ParentURIAbsolute
+
+	// ParentURIReject Reports them as Validate errors
+	ParentURIReject
+)
+
+// DurationRoundingModes indicates how the #EXTINF durations are rounded to the configured digits
+type DurationRoundingModes int
+
+const (
+	// DurationRoundingNearest Rounds to the nearest value (half away from zero)
+	DurationRoundingNearest DurationRoundingModes = iota
+
+	// DurationRoundingFloor Rounds down
+	DurationRoundingFloor
+
+	// DurationRoundingCeil Rounds up
+	DurationRoundingCeil
+)
+
+const (
+	// IndependentSegmentsMaxDurFactor Chunks longer than targetDurS * factor suggest long GOPs
+	IndependentSegmentsMaxDurFactor = 1.5
+)
+
+const (
+	// MinSlidingWindowSize Minimum number of chunks of a LiveWindow chunklist
+	MinSlidingWindowSize = 1
+
+	// InlineDataContentType Content type used in data URIs of inline chunks
+	InlineDataContentType = "video/mp2t"
+
+	// ProgramDateTimeFormat Format of #EXT-X-PROGRAM-DATE-TIME (ISO 8601 with milliseconds)
+	ProgramDateTimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+	// ProgramDateTimeOffsetFormat Format of #EXT-X-PROGRAM-DATE-TIME with explicit offset, +00:00 instead of Z for UTC
+	ProgramDateTimeOffsetFormat = "2006-01-02T15:04:05.000-07:00"
+)
+
+var (
+	// ErrChunkEmptyFileName Chunk without filename (it would write a blank URI line)
+	ErrChunkEmptyFileName = errors.New("chunk filename is empty")
+
+	// ErrServePathNotRooted Chunklist serve path that does not start with / (see SetServePath)
+	ErrServePathNotRooted = errors.New("chunklist serve path must start with /")
+
+	// ErrQuotedAttribute Value written as a quoted attribute that contains a double quote (see SetRejectQuotes)
+	ErrQuotedAttribute = errors.New("quoted attribute contains a double quote")
+
+	// ErrSegmentTooLong Chunk much longer than the target duration (see SetMaxSegmentDurationFactor)
+	ErrSegmentTooLong = errors.New("chunk duration exceeds the maximum")
+
+	// ErrV3CompatFMP4 fMP4 chunk (or init chunk) added in HLS v3 compatibility mode
+	ErrV3CompatFMP4 = errors.New("fMP4 and #EXT-X-MAP can not be used with HLS v3")
+
+	// ErrChunkBeforeInit fMP4 chunk added before SetInitChunk (strict mode)
+	ErrChunkBeforeInit = errors.New("fMP4 chunk added before the init chunk")
+
+	// ErrVodTooFewSegments VOD chunklist closed with less chunks than the configured minimum
+	ErrVodTooFewSegments = errors.New("VOD chunklist has less chunks than the minimum")
 )
 
 // Chunk Chunk information
@@ -51,6 +161,46 @@ type Chunk struct {
 	FileName  string
 	DurationS float64
 	IsDisco   bool
+	SizeBytes int64
+
+	// ProgramDateTime If not zero renders #EXT-X-PROGRAM-DATE-TIME before the chunk
+	ProgramDateTime time.Time
+
+	// Keys Keys that apply to this chunk (set by AddChunk from SetKeys)
+	Keys []Key
+
+	// InitFileName Init chunk of this chunk (set by AddChunk from SetInitChunk)
+	InitFileName string
+
+	// InitByteRangeLength Length of the init chunk inside InitFileName, 0 means whole file
+	InitByteRangeLength int64
+
+	// InitByteRangeOffset Offset of the init chunk inside InitFileName
+	InitByteRangeOffset int64
+
+	// InlineData If set, the chunk is rendered as a data URI instead of FileName (only for tiny test streams)
+	InlineData []byte
+
+	// Parts LL-HLS partial segments of this chunk (#EXT-X-PART)
+	Parts []Part
+
+	// Codecs Optional codecs of the chunk (ex: avc1.64001f,mp4a.40.2), used to detect format changes
+	Codecs string
+
+	// Resolution Optional resolution of the chunk (ex: 1280x720), used to detect format changes
+	Resolution string
+
+	// BitrateKbps If > 0 renders #EXT-X-BITRATE (approximate bitrate in kbit/s) when it changes from the previous chunk.
+	// 0 (unknown) renders no tag, so the chunk inherits the last rendered #EXT-X-BITRATE as the spec applies it
+	// to every following chunk
+	BitrateKbps int64
+
+	// SCTE35 Optional SCTE-35 splice_info_section of an ad starting at this chunk (see SetSCTE35Mode)
+	SCTE35 []byte
+
+	// Checksum Optional hash of the chunk written in a comment line for integrity tooling (see SetChecksumTag).
+	// AddChunk refuses it with ErrInvalidChecksum if it contains a line break
+	Checksum string
 }
 
 // Hls Hls chunklist
@@ -60,21 +210,93 @@ type Hls struct {
 	version               int
 	isIndependentSegments bool
 	targetDurS            float64
+	minTargetDurS         float64
+	targetDurFractional   bool
+	monotonicTargetDur    bool
+	maxSegmentDurFactor   float64
+	v3Compat              bool
+	startFraction         float64
+	startPrecise          bool
+	backupFiles           int
+	pdtOffsetForm         bool
+	maxAge                time.Duration
+	lastChunkTime         time.Time
+	discoOnNextChunk      bool
+	maxChunkDurS          float64
+	integerDurations      bool
+	durationRounding      DurationRoundingModes
+	durationDigits        int
+	skipEmptyFileName     bool
+	discoOnFormatChange   bool
+	beforeAdd             func(chunk *Chunk) error
+	segmentRenderer       func(chunk Chunk, w io.Writer) (bool, error)
+	minVodSegments        int
 	slidingWindowSize     int
+	windowDurationS       float64
+	windowCombinator      WindowCombinators
 	mseq                  int64
 	dseq                  int64
 	chunks                []Chunk
+	parts                 []Part
+	partTargetDurS        float64
+	lowLatency            bool
+	partRetentionSegments int
+	maxParts              int
+	clampPartDurations    bool
+	preloadHint           *PreloadHint
+	canSkipUntilS         float64
+	dateRanges            []DateRange
+	currentKeys           []Key
 	chunklistFileName     string
 	initChunkDataFileName string
+	initByteRangeLength   int64
+	initByteRangeOffset   int64
 	outputType            OutputTypes
 	httpClient            *http.Client
 	httpScheme            string
 	httpHost              string
+	chunkTransferMode     TransferModes
+	partTransferMode      TransferModes
+	webDAVCreateParents   bool
+	webDAVParentsCreated  map[string]bool
+	segmentBaseURL        string
+	absoluteURIs          bool
+	serveRoot             string
+	chunklistServePath    string
+	uriRewriter           func(uri string) string
+	parentURIMode         ParentURIModes
+	uriCase               URICaseModes
+	scte35Mode            SCTE35Modes
+	mseqFileNameRegexp    *regexp.Regexp
+	segmentQuery          string
+	omitZeroMseq          bool
+	compact               bool
+	strictMode            bool
+	rejectQuotes          bool
+	maxLineLength         int
+	now                   func() time.Time
+	lastPublishTime       time.Time
+	outputWriter          io.Writer
+	outputWriterDelimiter string
+	sinks                 []Sink
+	prePublish            func(sinkName string, data []byte) ([]byte, error)
+	checksumTag           string
+	auditWriter           io.Writer
+	fileFlushInterval     time.Duration
+	lastFileFlushTime     time.Time
+	pendingManifest       []byte
+	evictionPolicy        func(chunks []Chunk) int
+	onPublish             func(sizeBytes int)
+	publishedBytes        int64
+	onEvict               func(chunk Chunk, err error)
+	deleteEvicted         bool
+	evictionWorkers       chan struct{}
+	evictionWait          *sync.WaitGroup
 
 	isClosed bool
 }
 
-// New Creates a hls chunklist manifest
+// New Creates a hls chunklist manifest, a nil log uses the logrus standard logger
 func New(
 	log *logrus.Logger,
 	ManifestType ManifestTypes,
@@ -89,68 +311,509 @@ func New(
 	httpScheme string,
 	httpHost string,
 ) Hls {
+	if log == nil {
+		log = logrus.StandardLogger()
+	}
+
 	h := Hls{
-		log,
-		ManifestType,
-		version,
-		isIndependentSegments,
-		targetDurS,
-		slidingWindowSize,
-		0,
-		0,
-		make([]Chunk, 0),
-		chunklistFileName,
-		initChunkDataFileName,
-		outputType,
-		httpClient,
-		httpScheme,
-		httpHost,
-		false,
+		log:                   log,
+		manifestType:          ManifestType,
+		version:               version,
+		isIndependentSegments: isIndependentSegments,
+		targetDurS:            targetDurS,
+		slidingWindowSize:     slidingWindowSize,
+		mseq:                  0,
+		dseq:                  0,
+		chunks:                make([]Chunk, 0),
+		chunklistFileName:     chunklistFileName,
+		initChunkDataFileName: initChunkDataFileName,
+		outputType:            outputType,
+		httpClient:            httpClient,
+		httpScheme:            httpScheme,
+		httpHost:              httpHost,
+		chunkTransferMode:     TransferModeContentLength,
+		partTransferMode:      TransferModeChunked,
+		now:                   time.Now,
+		isClosed:              false,
 	}
 
+	h.checkSlidingWindowSize()
+
 	return h
 }
 
+// checkSlidingWindowSize Clamps the sliding window size of a LiveWindow chunklist to MinSlidingWindowSize
+// (a smaller one would evict all the chunks)
+func (p *Hls) checkSlidingWindowSize() {
+	if p.manifestType == LiveWindow && p.slidingWindowSize < MinSlidingWindowSize {
+		p.log.Warn("Invalid sliding window size ", p.slidingWindowSize, ", using ", MinSlidingWindowSize)
+		p.slidingWindowSize = MinSlidingWindowSize
+	}
+}
+
 // SetInitChunk Adds a chunk init infomation
 func (p *Hls) SetInitChunk(initChunkFileName string) {
 	p.initChunkDataFileName = initChunkFileName
+	p.initByteRangeLength = 0
+	p.initByteRangeOffset = 0
 }
 
-func (p *Hls) saveChunklist() error {
+// SetInitChunkByteRange Sets the init chunk as a byte range of initChunkFileName (ex: CMAF growing resource)
+func (p *Hls) SetInitChunkByteRange(initChunkFileName string, byteRangeLength int64, byteRangeOffset int64) {
+	p.initChunkDataFileName = initChunkFileName
+	p.initByteRangeLength = byteRangeLength
+	p.initByteRangeOffset = byteRangeOffset
+}
+
+func (p *Hls) saveChunklist(transferMode TransferModes) error {
+	p.closeIfStale()
+
+	if p.strictMode {
+		if err := p.Validate(); err != nil {
+			return err
+		}
+	}
+
+	return p.publish([]byte(p.String()), transferMode)
+}
+
+// publish Sends a rendered chunklist to the configured output, then to the sinks if it succeeded
+func (p *Hls) publish(hlsStrByte []byte, transferMode TransferModes) error {
 	ret := error(nil)
 
-	hlsStrByte := []byte(p.String())
+	if p.outputType == HlsOutputModeFile && p.fileFlushInterval > 0 {
+		p.pendingManifest = hlsStrByte
+		if p.now().Sub(p.lastFileFlushTime) >= p.fileFlushInterval {
+			ret = p.Flush()
+		}
+	} else if p.outputType != HlsOutputModeNone {
+		ret = p.saveManifest(p.outputType, MainOutputName, p.chunklistFileName, hlsStrByte, transferMode)
+		if ret == nil {
+			p.published(hlsStrByte)
+		}
+	}
+
+	if ret != nil {
+		return ret
+	}
+
+	return p.publishSinks(hlsStrByte, transferMode)
+}
 
-	if p.outputType == HlsOutputModeFile {
-		ret = p.saveManifestToFile(hlsStrByte)
-	} else if p.outputType == HlsOutputModeHTTP {
-		ret = p.saveManifestToHTTP(hlsStrByte)
+// saveManifest Saves a rendered chunklist as fileName to the output type, through the pre-publish hook
+func (p *Hls) saveManifest(outputType OutputTypes, outputName string, fileName string, manifestByte []byte, transferMode TransferModes) error {
+	manifestByte, err := p.prePublished(outputType, outputName, fileName, manifestByte)
+	if err != nil {
+		return err
+	}
+
+	return p.writeManifest(outputType, fileName, manifestByte, transferMode)
+}
+
+// prePublished Returns the bytes to save to the output outputName, as returned by the pre-publish hook (if any)
+func (p *Hls) prePublished(outputType OutputTypes, outputName string, fileName string, manifestByte []byte) ([]byte, error) {
+	if outputType == HlsOutputModeNone || p.prePublish == nil {
+		return manifestByte, nil
+	}
+
+	manifestByte, err := p.prePublish(outputName, manifestByte)
+	if err != nil {
+		p.log.Error("Chunklist ", fileName, " not published to ", outputName, ", pre-publish hook error: ", err)
+	}
+
+	return manifestByte, err
+}
+
+// writeManifest Writes the final chunklist bytes as fileName to the output type
+func (p *Hls) writeManifest(outputType OutputTypes, fileName string, manifestByte []byte, transferMode TransferModes) error {
+	ret := error(nil)
+
+	if outputType == HlsOutputModeFile {
+		ret = p.saveManifestToFile(fileName, manifestByte)
+	} else if outputType == HlsOutputModeHTTP {
+		ret = p.saveManifestToHTTP(fileName, manifestByte, transferMode)
+	} else if outputType == HlsOutputModeWebDAV {
+		ret = p.saveManifestToWebDAV(fileName, manifestByte, transferMode)
+	} else if outputType == HlsOutputModeWriter {
+		ret = p.saveManifestToWriter(fileName, manifestByte)
+	}
+
+	if ret == nil && outputType != HlsOutputModeNone {
+		p.publishedBytes += int64(len(manifestByte))
+		if p.onPublish != nil {
+			p.onPublish(len(manifestByte))
+		}
 	}
 
 	return ret
 }
 
+// published Updates the publish info after a successful save of the main output and sends a copy to the audit writer
+func (p *Hls) published(manifestByte []byte) {
+	p.lastPublishTime = p.now()
+
+	if p.auditWriter != nil {
+		auditByte := append([]byte("# "+p.lastPublishTime.Format(ProgramDateTimeFormat)+"\n"), manifestByte...)
+		if _, err := p.auditWriter.Write(auditByte); err != nil {
+			p.log.Error("Error writing ", p.chunklistFileName, " to audit writer. Error: ", err)
+		}
+	}
+}
+
+// SetPublishCallback Sets a function called after each successful chunklist save to an output (main output
+// and each sink) with the number of bytes written / uploaded, after the pre-publish hook and compression
+// (ex: to meter egress)
+func (p *Hls) SetPublishCallback(onPublish func(sizeBytes int)) {
+	p.onPublish = onPublish
+}
+
+// SetAuditWriter Sets a writer that receives a copy of each chunklist published to the main output (not the sinks)
+// prefixed by a timestamp line
+func (p *Hls) SetAuditWriter(auditWriter io.Writer) {
+	p.auditWriter = auditWriter
+}
+
+// SetFileFlushInterval Buffers the main output chunklist in file mode (the sinks are not buffered): it is written
+// at most once per interval, the last version is always written by Flush or CloseManifest (0 writes on each save).
+// There is no timer (Hls is not safe for concurrent use): a buffered chunklist is only written by a later save,
+// so if the source stalls the file stays stale until the caller calls Flush. Live callers should call Flush
+// periodically (ex: on a ticker of the interval, from the goroutine that adds the chunks)
+func (p *Hls) SetFileFlushInterval(interval time.Duration) {
+	p.fileFlushInterval = interval
+}
+
+// Flush Writes the buffered chunklist (if any) to file, it does nothing if there is no pending update
+func (p *Hls) Flush() error {
+	if p.pendingManifest == nil {
+		return nil
+	}
+
+	err := p.saveManifest(HlsOutputModeFile, MainOutputName, p.chunklistFileName, p.pendingManifest, p.chunkTransferMode)
+	if err != nil {
+		return err
+	}
+
+	p.published(p.pendingManifest)
+	p.pendingManifest = nil
+	p.lastFileFlushTime = p.lastPublishTime
+
+	return nil
+}
+
+// SetClock Sets the function used to get the current time (time.Now by default)
+func (p *Hls) SetClock(now func() time.Time) {
+	p.now = now
+}
+
+// SetMaxAge Closes the chunklist (#EXT-X-ENDLIST) when it is rendered after no chunk has been added for more than
+// maxAge (ex: source gone), so the players stop polling. The delay starts at the next added chunk.
+// The renders (String, Lint...) only add the tag, the chunklist is closed when it is published or at the next
+// added chunk, then as for CloseManifest it stays closed (RFC 8216 forbids changing it after #EXT-X-ENDLIST), see ReOpen.
+// 0 disables it
+func (p *Hls) SetMaxAge(maxAge time.Duration) {
+	p.maxAge = maxAge
+}
+
+// isStale Returns true if no chunk has been added for more than the max age
+func (p *Hls) isStale() bool {
+	return p.maxAge > 0 && !p.lastChunkTime.IsZero() && p.now().Sub(p.lastChunkTime) > p.maxAge
+}
+
+// closeIfStale Closes a stale chunklist for good, called before publishing and adding a chunk
+// (the renders only add #EXT-X-ENDLIST, they do not change the state)
+func (p *Hls) closeIfStale() {
+	if !p.isClosed && p.isStale() {
+		p.log.Warn("No chunk added to ", p.chunklistFileName, " for more than ", p.maxAge, ", closing it")
+		p.isClosed = true
+	}
+}
+
+// LastPublishTime Returns the time of the last successful chunklist save (zero if never saved)
+func (p *Hls) LastPublishTime() time.Time {
+	return p.lastPublishTime
+}
+
 // CloseManifest Adds a chunk init infomation
 func (p *Hls) CloseManifest(saveChunklist bool) error {
 	ret := error(nil)
 
+	if p.manifestType == Vod && len(p.chunks) < p.minVodSegments {
+		p.log.Error("Closing VOD chunklist ", p.chunklistFileName, " with ", len(p.chunks), " chunks, minimum ", p.minVodSegments)
+		return ErrVodTooFewSegments
+	}
+
 	p.isClosed = true
 
 	if saveChunklist {
-		ret = p.saveChunklist()
+		ret = p.saveChunklist(p.chunkTransferMode)
+	}
+
+	if ret == nil {
+		ret = p.Flush()
 	}
 
 	return ret
 }
 
+// SetMinVodSegments Sets the minimum number of chunks to close a VOD chunklist (catches truncated recordings), 0 means no minimum
+func (p *Hls) SetMinVodSegments(minVodSegments int) {
+	p.minVodSegments = minVodSegments
+}
+
+// ReOpen Reopens a closed chunklist (removes #EXT-X-ENDLIST) so chunks can be added again.
+// Clients may have already stopped reloading it, so it is only intended to fix a mistaken close
+func (p *Hls) ReOpen() {
+	if !p.isClosed {
+		return
+	}
+
+	p.log.Warn("Reopening closed chunklist ", p.chunklistFileName)
+	p.isClosed = false
+	// The max age delay restarts at the next chunk
+	p.lastChunkTime = time.Time{}
+}
+
+// SetSkipEmptyFileName Logs and skips the chunks added with an empty filename instead of returning ErrChunkEmptyFileName
+func (p *Hls) SetSkipEmptyFileName(skipEmptyFileName bool) {
+	p.skipEmptyFileName = skipEmptyFileName
+}
+
+// SetBeforeAdd Sets a callback called by AddChunk before adding each chunk: it can modify the chunk
+// (ex: round the duration) or return an error to not add it (AddChunk returns that error)
+func (p *Hls) SetBeforeAdd(beforeAdd func(chunk *Chunk) error) {
+	p.beforeAdd = beforeAdd
+}
+
+// SetSegmentRenderer Sets a hook that writes the whole block of a chunk (tags and URI) instead of the default
+// rendering when it returns true. On false or error the default rendering is used.
+// The next chunk is rendered as if the default block had been written (ex: MAP and KEY changes)
+func (p *Hls) SetSegmentRenderer(segmentRenderer func(chunk Chunk, w io.Writer) (bool, error)) {
+	p.segmentRenderer = segmentRenderer
+}
+
+// SetDiscontinuityOnFormatChange Flags a chunk as discontinuity when its Codecs or Resolution are different
+// from the previous chunk ones (empty values are unknown and never trigger it)
+func (p *Hls) SetDiscontinuityOnFormatChange(discoOnFormatChange bool) {
+	p.discoOnFormatChange = discoOnFormatChange
+}
+
+// formatChanged Returns true if the codecs or the resolution of the chunk are different from the previous one
+func formatChanged(previous Chunk, chunk Chunk) bool {
+	if previous.Codecs != "" && chunk.Codecs != "" && previous.Codecs != chunk.Codecs {
+		return true
+	}
+
+	return previous.Resolution != "" && chunk.Resolution != "" && previous.Resolution != chunk.Resolution
+}
+
+// SetIndependentSegments Enables / disables #EXT-X-INDEPENDENT-SEGMENTS.
+// This tag asserts that every chunk starts with a keyframe, so only enable it if the chunker cuts at random access points
+func (p *Hls) SetIndependentSegments(isIndependentSegments bool) {
+	p.isIndependentSegments = isIndependentSegments
+}
+
+// SetStartFraction Renders #EXT-X-START with a TIME-OFFSET of a fraction of the current chunklist duration back from
+// the end (ex: 0.6 starts 60% back from the live edge). The fraction is clamped to 1, 0 disables it
+func (p *Hls) SetStartFraction(startFraction float64, precise bool) {
+	p.startFraction = math.Min(math.Max(startFraction, 0), 1)
+	p.startPrecise = precise
+}
+
+// checkIndependentSegments Warns if a chunk suggests that #EXT-X-INDEPENDENT-SEGMENTS could be wrong
+func (p *Hls) checkIndependentSegments(chunkData Chunk) {
+	if !p.isIndependentSegments || p.targetDurS <= 0 {
+		return
+	}
+
+	if chunkData.DurationS > p.targetDurS*IndependentSegmentsMaxDurFactor {
+		p.log.Warn("Independent segments declared but chunk ", chunkData.FileName, " lasts ", chunkData.DurationS, "s (target ", p.targetDurS, "s), it suggests long GOPs")
+	}
+}
+
+// SetProgramDateTimeOffsetForm Writes #EXT-X-PROGRAM-DATE-TIME UTC times with an explicit +00:00 offset instead of Z
+func (p *Hls) SetProgramDateTimeOffsetForm(pdtOffsetForm bool) {
+	p.pdtOffsetForm = pdtOffsetForm
+}
+
+// programDateTimeFormat Returns the format of #EXT-X-PROGRAM-DATE-TIME
+func (p *Hls) programDateTimeFormat() string {
+	if p.pdtOffsetForm {
+		return ProgramDateTimeOffsetFormat
+	}
+
+	return ProgramDateTimeFormat
+}
+
+// SetMinTargetDuration Sets the minimum #EXT-X-TARGETDURATION to render (0 means no minimum)
+func (p *Hls) SetMinTargetDuration(minTargetDurS float64) {
+	p.minTargetDurS = minTargetDurS
+}
+
+// SetTargetDurationFractional Renders #EXT-X-TARGETDURATION with one decimal (ex: 6.0) instead of an integer
+func (p *Hls) SetTargetDurationFractional(targetDurFractional bool) {
+	p.targetDurFractional = targetDurFractional
+}
+
+// SetMaxSegmentDurationFactor Refuses (ErrSegmentTooLong) the chunks longer than the target duration * factor
+// (ex: encoder hiccup), since players can reject the whole chunklist. 0 disables it
+func (p *Hls) SetMaxSegmentDurationFactor(maxSegmentDurFactor float64) {
+	p.maxSegmentDurFactor = maxSegmentDurFactor
+}
+
+// SetMonotonicTargetDuration Computes the target duration from the longest chunk ever added instead of
+// the longest retained one, so it never decreases when chunks are evicted
+func (p *Hls) SetMonotonicTargetDuration(monotonicTargetDur bool) {
+	p.monotonicTargetDur = monotonicTargetDur
+}
+
+// maxTargetDurationS Returns max(minTarget, target, longest chunk).
+// Only completed chunks count, LL-HLS parts (pending or not) never lower or raise it
+func (p *Hls) maxTargetDurationS() float64 {
+	maxDurS := p.targetDurS
+	if p.monotonicTargetDur && p.maxChunkDurS > maxDurS {
+		maxDurS = p.maxChunkDurS
+	}
+	for _, chunk := range p.chunks {
+		if chunk.DurationS > maxDurS {
+			maxDurS = chunk.DurationS
+		}
+	}
+
+	return math.Max(maxDurS, p.minTargetDurS)
+}
+
+// targetDuration Returns the integer target duration: max(minTarget, ceil(max(target, longest chunk)))
+func (p *Hls) targetDuration() int64 {
+	return int64(math.Ceil(p.maxTargetDurationS()))
+}
+
+// targetDurationString Returns the target duration to render, integer ceil or one decimal ceil if fractional
+func (p *Hls) targetDurationString() string {
+	if p.targetDurFractional {
+		return fmt.Sprintf("%.1f", math.Ceil(p.maxTargetDurationS()*10)/10)
+	}
+
+	return strconv.FormatInt(p.targetDuration(), 10)
+}
+
+// SetSegmentBaseURL Sets a base URL prepended to every chunk URI (media and init), separated by exactly one slash
+func (p *Hls) SetSegmentBaseURL(baseURL string) {
+	p.segmentBaseURL = baseURL
+}
+
+// SetServePath Computes the chunk URIs for a chunklist served at chunklistServePath (ex: "/chunklist.m3u8")
+// instead of its disk path. serveRoot is the disk directory served as web root (chunk paths are relative to it).
+// chunklistServePath must be rooted (ErrServePathNotRooted), the chunks outside serveRoot keep their disk relative URI
+func (p *Hls) SetServePath(serveRoot string, chunklistServePath string) error {
+	if chunklistServePath != "" && !strings.HasPrefix(chunklistServePath, "/") {
+		return ErrServePathNotRooted
+	}
+
+	p.serveRoot = serveRoot
+	p.chunklistServePath = chunklistServePath
+
+	return nil
+}
+
+// SetAbsoluteURIs Writes the chunk URIs as absolute URLs made of the HTTP scheme, host and chunk path
+// (the same ones used to upload in HTTP output mode). It takes precedence over the segment base URL
+func (p *Hls) SetAbsoluteURIs(absoluteURIs bool) {
+	p.absoluteURIs = absoluteURIs
+}
+
+// SetParentURIMode Sets how the relative URIs that contain .. (chunks above the chunklist directory) are handled,
+// some restrictive players reject them
+func (p *Hls) SetParentURIMode(parentURIMode ParentURIModes) {
+	p.parentURIMode = parentURIMode
+}
+
+// isParentURI Returns true if a relative URI goes up a directory
+func isParentURI(uri string) bool {
+	return uri == ".." || strings.HasPrefix(uri, "../")
+}
+
+// SetMediaSequenceFromFileName Derives the rendered media sequence from the filename of the 1st chunk
+// (ex: seg_(\d+)\.ts$), using the 1st submatch (or the whole match) as number.
+// If the filename does not match, the counted media sequence is used. nil disables it
+func (p *Hls) SetMediaSequenceFromFileName(mseqFileNameRegexp *regexp.Regexp) {
+	p.mseqFileNameRegexp = mseqFileNameRegexp
+}
+
+// mediaSequence Returns the media sequence to render
+func (p *Hls) mediaSequence() int64 {
+	if p.mseqFileNameRegexp == nil || len(p.chunks) == 0 {
+		return p.mseq
+	}
+
+	match := p.mseqFileNameRegexp.FindStringSubmatch(path.Base(p.chunks[0].FileName))
+	if match == nil {
+		p.log.Debug("Media sequence not found in ", p.chunks[0].FileName, ", using ", p.mseq)
+		return p.mseq
+	}
+
+	seqStr := match[0]
+	if len(match) > 1 {
+		seqStr = match[1]
+	}
+	mseq, err := strconv.ParseInt(seqStr, 10, 64)
+	if err != nil {
+		p.log.Debug("Invalid media sequence ", seqStr, " in ", p.chunks[0].FileName, ", using ", p.mseq)
+		return p.mseq
+	}
+
+	return mseq
+}
+
+// SetURICase Sets the case transform of the chunk and init URIs paths (ex: for case sensitive origins).
+// The segment base URL and the query are not transformed
+func (p *Hls) SetURICase(uriCase URICaseModes) {
+	p.uriCase = uriCase
+}
+
+// uriPathCase Returns the URI path with the configured case
+func (p *Hls) uriPathCase(uriPath string) string {
+	switch p.uriCase {
+	case URICaseLower:
+		return strings.ToLower(uriPath)
+	case URICaseUpper:
+		return strings.ToUpper(uriPath)
+	}
+
+	return uriPath
+}
+
+// SetSegmentQuery Sets a query string (ex: auth token) appended to every chunk URI (media and init),
+// after the query the URI may already have
+func (p *Hls) SetSegmentQuery(query string) {
+	p.segmentQuery = strings.TrimPrefix(query, "?")
+}
+
+// SetOmitZeroMediaSequence Omits #EXT-X-MEDIA-SEQUENCE in VOD chunklists when it is 0 (the default value).
+// Live chunklists always have it
+func (p *Hls) SetOmitZeroMediaSequence(omitZeroMseq bool) {
+	p.omitZeroMseq = omitZeroMseq
+}
+
+// SetCompact Omits the tags with the spec default value: #EXT-X-VERSION:1, #EXT-X-DISCONTINUITY-SEQUENCE:0
+// and #EXT-X-MEDIA-SEQUENCE:0 in VOD chunklists
+func (p *Hls) SetCompact(compact bool) {
+	p.compact = compact
+}
+
 // SetHlsVersion Sets manifest version
 func (p *Hls) SetHlsVersion(version int) {
 	p.version = version
 }
 
-func (p *Hls) saveManifestToFile(manifestByte []byte) error {
-	if p.chunklistFileName != "" {
-		err := ioutil.WriteFile(p.chunklistFileName, manifestByte, 0644)
+func (p *Hls) saveManifestToFile(fileName string, manifestByte []byte) error {
+	if fileName != "" {
+		if p.backupFiles > 0 {
+			if err := p.saveManifestBackup(fileName, manifestByte); err != nil {
+				return err
+			}
+		}
+
+		err := ioutil.WriteFile(fileName, manifestByte, 0644)
 		if err != nil {
 			return err
 		}
@@ -159,69 +822,624 @@ func (p *Hls) saveManifestToFile(manifestByte []byte) error {
 	return nil
 }
 
-func (p *Hls) saveManifestToHTTP(manifestByte []byte) error {
+// SetBackupFiles Keeps the last backupFiles published chunklists in file output mode (chunklist.m3u8.1 the newest
+// to chunklist.m3u8.N the oldest), the newest is written before the chunklist so it survives a crash mid-publish. 0 disables it
+func (p *Hls) SetBackupFiles(backupFiles int) {
+	p.backupFiles = backupFiles
+}
+
+// backupFileName Returns the name of the backup n of fileName (1 is the newest)
+func (p *Hls) backupFileName(fileName string, n int) string {
+	return fileName + "." + strconv.Itoa(n)
+}
 
-	if p.chunklistFileName != "" {
-		req := &http.Request{
-			Method: "POST",
-			URL: &url.URL{
-				Scheme: p.httpScheme,
-				Host:   p.httpHost,
-				Path:   "/" + p.chunklistFileName,
-			},
-			ProtoMajor:    1,
-			ProtoMinor:    1,
-			ContentLength: -1,
-			Body:          ioutil.NopCloser(bytes.NewReader(manifestByte)),
-			Header:        http.Header{},
+// saveManifestBackup Rotates the backups and writes the chunklist as the newest one
+func (p *Hls) saveManifestBackup(fileName string, manifestByte []byte) error {
+	for n := p.backupFiles - 1; n >= 1; n-- {
+		err := os.Rename(p.backupFileName(fileName, n), p.backupFileName(fileName, n+1))
+		if err != nil && !os.IsNotExist(err) {
+			return err
 		}
+	}
+
+	return ioutil.WriteFile(p.backupFileName(fileName, 1), manifestByte, 0644)
+}
+
+// SetTransferModes Sets the HTTP transfer mode of the publishes done adding chunks (or closing)
+// and adding parts. By default chunks are sent with Content-Length and parts chunked
+func (p *Hls) SetTransferModes(chunkTransferMode TransferModes, partTransferMode TransferModes) {
+	p.chunkTransferMode = chunkTransferMode
+	p.partTransferMode = partTransferMode
+}
+
+// newHTTPRequest Creates an upload request of data to filePath in the configured host
+func (p *Hls) newHTTPRequest(method string, filePath string, data []byte, transferMode TransferModes) *http.Request {
+	contentLength := int64(len(data))
+	if transferMode == TransferModeChunked {
+		contentLength = -1
+	}
 
-		if strings.ToLower(path.Ext(p.chunklistFileName)) == ".m3u8" {
-			req.Header.Set("Content-Type", "application/vnd.apple.mpegurl")
+	req := &http.Request{
+		Method: method,
+		URL: &url.URL{
+			Scheme: p.httpScheme,
+			Host:   p.httpHost,
+			Path:   "/" + filePath,
+		},
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		ContentLength: contentLength,
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		Header:        http.Header{},
+	}
+
+	if strings.ToLower(path.Ext(filePath)) == ".m3u8" {
+		req.Header.Set("Content-Type", "application/vnd.apple.mpegurl")
+	}
+
+	return req
+}
+
+// doHTTPRequest Sends a request, any network error or status not accepted is returned as error
+func (p *Hls) doHTTPRequest(req *http.Request, acceptedStatus ...int) error {
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	for _, status := range acceptedStatus {
+		if resp.StatusCode == status {
+			return nil
 		}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
 
-		_, err := p.httpClient.Do(req)
+	return nil
+}
 
+func (p *Hls) saveManifestToHTTP(fileName string, manifestByte []byte, transferMode TransferModes) error {
+
+	if fileName != "" {
+		err := p.doHTTPRequest(p.newHTTPRequest("POST", fileName, manifestByte, transferMode))
 		if err != nil {
-			p.log.Error("Error uploading ", p.chunklistFileName, ". Error: ", err)
-		} else {
-			p.log.Debug("Upload of ", p.chunklistFileName, " complete")
+			p.log.Error("Error uploading ", fileName, ". Error: ", err)
+			return err
 		}
+
+		p.log.Debug("Upload of ", fileName, " complete")
 	}
 
 	return nil
 }
 
-// AddChunk Adds a new chunk
+// AddChunk Adds a new chunk, a chunk with parts is refused with ErrPartTargetNotSet until SetPartTargetDuration is called
 func (p *Hls) AddChunk(chunkData Chunk, saveChunklist bool) error {
 	ret := error(nil)
 
-	p.chunks = append(p.chunks, chunkData)
+	p.closeIfStale()
+
+	if p.beforeAdd != nil {
+		if err := p.beforeAdd(&chunkData); err != nil {
+			p.log.Debug("Chunk ", chunkData.FileName, " not added. Error: ", err)
+			return err
+		}
+	}
+
+	if chunkData.FileName == "" && chunkData.InlineData == nil {
+		if p.skipEmptyFileName {
+			p.log.Warn("Skipping chunk with empty filename, duration ", chunkData.DurationS)
+			return nil
+		}
+		return ErrChunkEmptyFileName
+	}
+
+	if p.maxSegmentDurFactor > 0 && p.targetDurS > 0 && chunkData.DurationS > p.targetDurS*p.maxSegmentDurFactor {
+		p.log.Error("Chunk ", chunkData.FileName, " lasts ", chunkData.DurationS, "s, more than ", p.maxSegmentDurFactor, " times the target ", p.targetDurS, "s")
+		return ErrSegmentTooLong
+	}
+
+	if strings.ContainsAny(chunkData.Checksum, "\r\n") {
+		return ErrInvalidChecksum
+	}
 
-	if p.manifestType == LiveWindow && len(p.chunks) > p.slidingWindowSize {
-		//Remove first
-		if p.chunks[0].IsDisco {
+	p.checkIndependentSegments(chunkData)
 
+	if p.rejectQuotes {
+		for _, fileName := range append([]string{chunkData.InitFileName}, partFileNames(chunkData.Parts)...) {
+			if strings.Contains(p.chunkURI(fileName), "\"") {
+				return ErrQuotedAttribute
+			}
+		}
+	}
+
+	if len(chunkData.Parts) > 0 && p.partTargetDurS <= 0 {
+		return ErrPartTargetNotSet
+	}
+
+	if chunkData.Keys == nil {
+		chunkData.Keys = p.currentKeys
+	}
+	if chunkData.InitFileName == "" {
+		chunkData.InitFileName = p.initChunkDataFileName
+		chunkData.InitByteRangeLength = p.initByteRangeLength
+		chunkData.InitByteRangeOffset = p.initByteRangeOffset
+	}
+	if p.v3Compat && (chunkData.InitFileName != "" || isFragmentedMP4(chunkData.FileName)) {
+		return ErrV3CompatFMP4
+	}
+	if chunkData.InitFileName == "" && isFragmentedMP4(chunkData.FileName) {
+		if p.strictMode {
+			return ErrChunkBeforeInit
+		}
+		p.log.Warn("fMP4 chunk ", chunkData.FileName, " added before the init chunk, its #EXT-X-MAP is rendered once SetInitChunk is called")
+	}
+	if chunkData.Parts == nil {
+		chunkData.Parts = p.parts
+	}
+	p.parts = nil
+
+	if p.discoOnNextChunk {
+		chunkData.IsDisco = true
+		p.discoOnNextChunk = false
+	}
+	if p.discoOnFormatChange && len(p.chunks) > 0 && formatChanged(p.chunks[len(p.chunks)-1], chunkData) {
+		p.log.Debug("Format change detected on chunk ", chunkData.FileName, ", adding a discontinuity")
+		chunkData.IsDisco = true
+	}
+
+	p.chunks = append(p.chunks, chunkData)
+	p.pruneParts()
+	if p.maxAge > 0 {
+		p.lastChunkTime = p.now()
+	}
+	if chunkData.DurationS > p.maxChunkDurS {
+		p.maxChunkDurS = chunkData.DurationS
+	}
+
+	if p.manifestType == LiveWindow {
+		evicted := false
+		for evictCount := p.evictCount(); evictCount > 0; evictCount-- {
+			//Remove first
+			if p.chunks[0].IsDisco {
+				p.dseq++
+			}
+			p.evicted(p.chunks[0])
+			p.chunks = p.chunks[1:]
+			p.mseq++
+			evicted = true
+		}
+		if evicted {
+			p.pruneDateRanges()
 		}
-		p.chunks = p.chunks[1:]
-		p.mseq++
 	}
 
 	if saveChunklist {
-		ret = p.saveChunklist()
+		ret = p.saveChunklist(p.chunkTransferMode)
 	}
 
 	return ret
 }
 
-// String write info to chunklist.m3u8
-func (p *Hls) String() string {
+// NormalizeDiscontinuities Removes redundant discontinuities: consecutive discontinuity flags
+// are collapsed in the first one, and a leading discontinuity is dropped on a fresh playlist (nothing evicted yet).
+// The discontinuity sequence is increased by the removed flags, so the chunks after them (the live edge)
+// keep their discontinuity sequence number. Returns the number of removed discontinuities
+func (p *Hls) NormalizeDiscontinuities() int {
+	removed := 0
+
+	// The runs are detected on the flags before normalizing (ex: a window of only discontinuities)
+	previousDisco := false
+	for i := range p.chunks {
+		isDisco := p.chunks[i].IsDisco
+		if isDisco && ((i == 0 && p.mseq == 0 && p.dseq == 0) || previousDisco) {
+			p.chunks[i].IsDisco = false
+			removed++
+		}
+		previousDisco = isDisco
+	}
+	p.dseq += int64(removed)
+
+	return removed
+}
+
+// EstimateBandwidth Estimates peak and average bandwidth (bits per second) from the chunks sizes and durations.
+// Chunks without size or duration are ignored. Values are suitable for Variant.Bandwidth and Variant.AverageBandwidth
+func (p *Hls) EstimateBandwidth() (peakBps int64, averageBps int64) {
+	totalBits := 0.0
+	totalDurS := 0.0
+	peak := 0.0
+
+	for _, chunk := range p.chunks {
+		if chunk.SizeBytes <= 0 || chunk.DurationS <= 0 {
+			continue
+		}
+
+		bits := float64(chunk.SizeBytes) * 8
+		if bps := bits / chunk.DurationS; bps > peak {
+			peak = bps
+		}
+
+		totalBits = totalBits + bits
+		totalDurS = totalDurS + chunk.DurationS
+	}
+
+	peakBps = int64(math.Ceil(peak))
+	if totalDurS > 0 {
+		averageBps = int64(math.Ceil(totalBits / totalDurS))
+	}
+
+	return
+}
+
+// durationAccumulator Sums durations with Kahan compensated summation, so drift stays bounded over many chunks
+type durationAccumulator struct {
+	sum          float64
+	compensation float64
+}
+
+// Add Adds a duration to the sum
+func (a *durationAccumulator) Add(durationS float64) {
+	y := durationS - a.compensation
+	t := a.sum + y
+	a.compensation = (t - a.sum) - y
+	a.sum = t
+}
+
+// Sum Returns the current sum
+func (a *durationAccumulator) Sum() float64 {
+	return a.sum
+}
+
+// TotalDuration Returns the sum of the chunks durations
+func (p *Hls) TotalDuration() float64 {
+	var totalDurS durationAccumulator
+
+	for _, chunk := range p.chunks {
+		totalDurS.Add(chunk.DurationS)
+	}
+
+	return totalDurS.Sum()
+}
+
+// TruncateToDuration Drops trailing chunks once the cumulative duration exceeds maxS.
+// If keepCrossingChunk is true the chunk that crosses maxS is kept. Init chunk and sequences are preserved
+func (p *Hls) TruncateToDuration(maxS float64, keepCrossingChunk bool) {
+	var totalDurS durationAccumulator
+
+	for i, chunk := range p.chunks {
+		totalDurS.Add(chunk.DurationS)
+		if totalDurS.Sum() > maxS {
+			if keepCrossingChunk {
+				i++
+			}
+			p.chunks = p.chunks[:i]
+			break
+		}
+	}
+}
+
+// SplitAtDiscontinuities Returns one closed VOD chunklist per group of chunks between discontinuities (ex: chapters).
+// Each one is named after the chunklist with its number (ex: chunklist_1.m3u8) and keeps the output and render settings,
+// chunk init files are preserved. Date ranges, sinks and the publish state are not copied
+func (p *Hls) SplitAtDiscontinuities() []Hls {
+	ret := make([]Hls, 0)
+
+	start := 0
+	for i := 1; i <= len(p.chunks); i++ {
+		if i < len(p.chunks) && !p.chunks[i].IsDisco {
+			continue
+		}
+
+		n := len(ret) + 1
+		sub := New(p.log, Vod, p.version, p.isIndependentSegments, p.targetDurS, 0, numberedFileName(p.chunklistFileName, n), p.initChunkDataFileName, p.outputType, p.httpClient, p.httpScheme, p.httpHost)
+		sub.copySettings(p)
+		if p.chunklistServePath != "" {
+			sub.chunklistServePath = numberedFileName(p.chunklistServePath, n)
+		}
+		sub.chunks = append([]Chunk(nil), p.chunks[start:i]...)
+		sub.chunks[0].IsDisco = false
+		sub.isClosed = true
+
+		ret = append(ret, sub)
+		start = i
+	}
+
+	return ret
+}
+
+// numberedFileName Returns fileName with _n before the extension (ex: chunklist_1.m3u8)
+func numberedFileName(fileName string, n int) string {
+	ext := path.Ext(fileName)
+
+	return strings.TrimSuffix(fileName, ext) + "_" + strconv.Itoa(n) + ext
+}
+
+// copySettings Copies the render, add and output settings of src (not its chunks, parts, sequences, sliding window,
+// eviction, delta updates, sinks nor its publish state)
+func (p *Hls) copySettings(src *Hls) {
+	p.minTargetDurS = src.minTargetDurS
+	p.targetDurFractional = src.targetDurFractional
+	p.monotonicTargetDur = src.monotonicTargetDur
+	p.maxSegmentDurFactor = src.maxSegmentDurFactor
+	p.v3Compat = src.v3Compat
+	p.startFraction = src.startFraction
+	p.startPrecise = src.startPrecise
+	p.backupFiles = src.backupFiles
+	p.pdtOffsetForm = src.pdtOffsetForm
+	p.integerDurations = src.integerDurations
+	p.durationRounding = src.durationRounding
+	p.durationDigits = src.durationDigits
+	p.skipEmptyFileName = src.skipEmptyFileName
+	p.discoOnFormatChange = src.discoOnFormatChange
+	p.beforeAdd = src.beforeAdd
+	p.segmentRenderer = src.segmentRenderer
+	p.minVodSegments = src.minVodSegments
+	p.partTargetDurS = src.partTargetDurS
+	p.lowLatency = src.lowLatency
+	p.partRetentionSegments = src.partRetentionSegments
+	p.maxParts = src.maxParts
+	p.clampPartDurations = src.clampPartDurations
+	p.initByteRangeLength = src.initByteRangeLength
+	p.initByteRangeOffset = src.initByteRangeOffset
+	p.chunkTransferMode = src.chunkTransferMode
+	p.partTransferMode = src.partTransferMode
+	p.webDAVCreateParents = src.webDAVCreateParents
+	p.segmentBaseURL = src.segmentBaseURL
+	p.absoluteURIs = src.absoluteURIs
+	p.serveRoot = src.serveRoot
+	p.uriRewriter = src.uriRewriter
+	p.parentURIMode = src.parentURIMode
+	p.uriCase = src.uriCase
+	p.scte35Mode = src.scte35Mode
+	p.mseqFileNameRegexp = src.mseqFileNameRegexp
+	p.segmentQuery = src.segmentQuery
+	p.omitZeroMseq = src.omitZeroMseq
+	p.compact = src.compact
+	p.strictMode = src.strictMode
+	p.rejectQuotes = src.rejectQuotes
+	p.maxLineLength = src.maxLineLength
+	p.checksumTag = src.checksumTag
+	p.now = src.now
+	p.outputWriter = src.outputWriter
+	p.outputWriterDelimiter = src.outputWriterDelimiter
+	p.prePublish = src.prePublish
+	p.fileFlushInterval = src.fileFlushInterval
+	p.onPublish = src.onPublish
+}
+
+// WriteToContext Writes the chunklist to w line by line, it stops and returns ctx.Err() if ctx is done before finishing
+func (p *Hls) WriteToContext(ctx context.Context, w io.Writer) (int64, error) {
+	totalBytes := int64(0)
+	manifestByte := []byte(p.String())
+
+	for len(manifestByte) > 0 {
+		if err := ctx.Err(); err != nil {
+			return totalBytes, err
+		}
+
+		lineEnd := bytes.IndexByte(manifestByte, '\n') + 1
+		if lineEnd <= 0 {
+			lineEnd = len(manifestByte)
+		}
+
+		n, err := w.Write(manifestByte[:lineEnd])
+		totalBytes = totalBytes + int64(n)
+		if err != nil {
+			return totalBytes, err
+		}
+
+		manifestByte = manifestByte[lineEnd:]
+	}
+
+	return totalBytes, nil
+}
+
+// chunkURI Returns the URI of a chunk as seen from the chunklist, applying base URL and query
+func (p *Hls) chunkURI(fileName string) string {
+	if hasURIScheme(fileName) {
+		return p.rewriteURI(fileName)
+	}
+
+	uri, err := filepath.Rel(path.Dir(p.chunklistFileName), fileName)
+	if err != nil {
+		uri = fileName
+	}
+	if p.chunklistServePath != "" {
+		if servedURI, err := p.servedURI(fileName); err == nil {
+			uri = servedURI
+		} else {
+			p.log.Debug("Chunk ", fileName, " is not served from ", p.serveRoot, ", using its disk relative URI. Error: ", err)
+		}
+	}
+
+	if p.absoluteURIs || (p.parentURIMode == ParentURIAbsolute && isParentURI(uri)) {
+		uri = (&url.URL{Scheme: p.httpScheme, Host: p.httpHost, Path: p.uriPathCase("/" + strings.TrimPrefix(fileName, "/"))}).String()
+	} else {
+		uri = p.uriPathCase(uri)
+		if p.segmentBaseURL != "" {
+			uri = strings.TrimRight(p.segmentBaseURL, "/") + "/" + strings.TrimLeft(uri, "/")
+		}
+	}
+
+	if p.segmentQuery != "" {
+		separator := "?"
+		if strings.Contains(uri, "?") {
+			separator = "&"
+		}
+		uri = uri + separator + p.segmentQuery
+	}
+
+	return p.rewriteURI(uri)
+}
+
+// servedURI Returns the URI of a chunk relative to the chunklist serve path
+func (p *Hls) servedURI(fileName string) (string, error) {
+	chunkServePath, err := filepath.Rel(p.serveRoot, fileName)
+	if err != nil {
+		return "", err
+	}
+	if isParentURI(chunkServePath) {
+		return "", fmt.Errorf("%s is outside of %s", fileName, p.serveRoot)
+	}
+
+	return filepath.Rel(path.Dir(p.chunklistServePath), "/"+chunkServePath)
+}
+
+// rewriteURI Applies the URI rewriter (if any)
+func (p *Hls) rewriteURI(uri string) string {
+	if p.uriRewriter != nil {
+		uri = p.uriRewriter(uri)
+	}
+
+	return uri
+}
+
+// hasURIScheme Returns true if the URI starts with a scheme (ex: https://cdn/chunk.ts, data:...)
+func hasURIScheme(uri string) bool {
+	u, err := url.Parse(uri)
+
+	return err == nil && len(u.Scheme) > 1
+}
+
+// quotedURI Returns the URI of a chunk to write as a quoted attribute
+func (p *Hls) quotedURI(fileName string) string {
+	return escapeQuotes(p.chunkURI(fileName))
+}
+
+// quotesEscaper Percent encodes the characters not allowed in a quoted attribute
+var quotesEscaper = strings.NewReplacer("\"", "%22", "\r", "%0D", "\n", "%0A")
+
+// escapeQuotes Percent encodes the double quotes and line breaks of a value written as a quoted attribute,
+// so a rendered line is never broken (see SetRejectQuotes to refuse them)
+func escapeQuotes(value string) string {
+	return quotesEscaper.Replace(value)
+}
+
+// extinfString Returns the #EXTINF line of a chunk, the trailing comma is always written (even for zero durations)
+func (p *Hls) extinfString(ctx renderContext, chunk Chunk) string {
+	if ctx.integerDurations {
+		return "#EXTINF:" + strconv.FormatInt(int64(chunk.DurationS), 10) + ",\n"
+	}
+
+	if p.durationDigits > 0 {
+		durationS := roundDuration(chunk.DurationS, p.durationRounding, p.durationDigits)
+		return "#EXTINF:" + strconv.FormatFloat(durationS, 'f', p.durationDigits, 64) + ",\n"
+	}
+
+	return "#EXTINF:" + fmt.Sprintf("%.8f", chunk.DurationS) + ",\n"
+}
+
+// SetRoundDurationsToMs Writes the #EXTINF durations rounded to milliseconds, same as
+// SetDurationRounding(DurationRoundingNearest, 3). false restores the default 8 decimals
+func (p *Hls) SetRoundDurationsToMs(roundDurationsToMs bool) {
+	if roundDurationsToMs {
+		p.SetDurationRounding(DurationRoundingNearest, 3)
+	} else {
+		p.SetDurationRounding(DurationRoundingNearest, 0)
+	}
+}
+
+// SetDurationRounding Writes the #EXTINF durations with digits decimals rounded by mode (0 digits keeps the
+// default 8 decimals). Only the written value is rounded, TotalDuration uses the exact durations
+func (p *Hls) SetDurationRounding(mode DurationRoundingModes, digits int) {
+	p.durationRounding = mode
+	p.durationDigits = digits
+}
+
+// roundDuration Rounds a duration to digits decimals. The binary representation errors are snapped
+// to the decimal value first (ex: 6.0055 * 1000 = 6005.4999...)
+func roundDuration(durationS float64, mode DurationRoundingModes, digits int) float64 {
+	scale := math.Pow10(digits)
+	scaled := durationS * scale
+	if snapped := math.Round(scaled*2) / 2; math.Abs(scaled-snapped) < 1e-6 {
+		scaled = snapped
+	}
+
+	if mode == DurationRoundingFloor {
+		scaled = math.Floor(scaled)
+	} else if mode == DurationRoundingCeil {
+		scaled = math.Ceil(scaled)
+	} else {
+		scaled = math.Round(scaled)
+	}
+
+	return scaled / scale
+}
+
+// SetIntegerDurations Enables integer #EXTINF durations (legacy version <= 2 chunklists).
+// They are only used when the durations of all the chunks are whole seconds
+func (p *Hls) SetIntegerDurations(integerDurations bool) {
+	p.integerDurations = integerDurations
+}
+
+// allWholeDurations Returns true if all the chunk durations are whole seconds
+func (p *Hls) allWholeDurations() bool {
+	for _, chunk := range p.chunks {
+		if chunk.DurationS != math.Trunc(chunk.DurationS) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// renderContext Values of the whole chunklist computed once per render
+type renderContext struct {
+	// version Rendered #EXT-X-VERSION
+	version int
+
+	// integerDurations Writes integer #EXTINF durations (see SetIntegerDurations)
+	integerDurations bool
+
+	// dateRangeIndexes Index of the chunk that contains each date range start (see dateRangeChunkIndex)
+	dateRangeIndexes []int
+
+	// closed Renders #EXT-X-ENDLIST: closed or stale chunklist (see SetMaxAge)
+	closed bool
+
+	// stripTags Omits the optional tags not supported by version (render below the chunklist version, see Sink.Version)
+	stripTags bool
+}
+
+// newRenderContext Returns the render values of the chunklist at version
+func (p *Hls) newRenderContext(version int) renderContext {
+	ctx := renderContext{
+		version:          version,
+		integerDurations: p.integerDurations && version <= 2 && p.allWholeDurations(),
+		closed:           p.isClosed || p.isStale(),
+		dateRangeIndexes: make([]int, 0, len(p.dateRanges)),
+	}
+	for _, dateRange := range p.dateRanges {
+		ctx.dateRangeIndexes = append(ctx.dateRangeIndexes, p.dateRangeChunkIndex(dateRange))
+	}
+
+	return ctx
+}
+
+// RenderHeader Returns the chunklist tags before the first chunk (from #EXTM3U to #EXT-X-MAP)
+func (p *Hls) RenderHeader() string {
+	return p.renderHeader(p.newRenderContext(p.EffectiveVersion()), 0, 0)
+}
+
+// renderHeader Returns the chunklist tags before the chunk headIndex, the #EXT-X-MAP is the one of
+// the chunk mapIndex (the first rendered one)
+func (p *Hls) renderHeader(ctx renderContext, headIndex int, mapIndex int) string {
 	var buffer bytes.Buffer
 
 	buffer.WriteString("#EXTM3U\n")
-	buffer.WriteString("#EXT-X-VERSION:" + strconv.Itoa(p.version) + "\n")
-	buffer.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatInt(p.mseq, 10) + "\n")
-	buffer.WriteString("#EXT-X-DISCONTINUITY-SEQUENCE:" + strconv.FormatInt(p.dseq, 10) + "\n")
+	if !p.compact || ctx.version != 1 {
+		buffer.WriteString("#EXT-X-VERSION:" + strconv.Itoa(ctx.version) + "\n")
+	}
+	mseq := p.mediaSequence()
+	if !(p.omitZeroMseq || p.compact) || p.manifestType != Vod || mseq != 0 {
+		buffer.WriteString("#EXT-X-MEDIA-SEQUENCE:" + strconv.FormatInt(mseq, 10) + "\n")
+	}
+	if !p.compact || p.dseq != 0 {
+		buffer.WriteString("#EXT-X-DISCONTINUITY-SEQUENCE:" + strconv.FormatInt(p.dseq, 10) + "\n")
+	}
 
 	if p.manifestType == Vod {
 		buffer.WriteString("#EXT-X-PLAYLIST-TYPE:VOD\n")
@@ -230,28 +1448,190 @@ func (p *Hls) String() string {
 		buffer.WriteString("#EXT-X-PLAYLIST-TYPE:EVENT\n")
 	}
 
-	buffer.WriteString("#EXT-X-TARGETDURATION:" + fmt.Sprintf("%.0f", p.targetDurS) + "\n")
+	buffer.WriteString("#EXT-X-TARGETDURATION:" + p.targetDurationString() + "\n")
+
+	lowLatency := p.partTargetDurS > 0 && p.isLowLatency()
+
+	serverControl := make([]string, 0)
+	if p.canSkipUntilS > 0 && !(ctx.stripTags && ctx.version < HlsVersionSkip) {
+		serverControl = append(serverControl, "CAN-SKIP-UNTIL="+fmt.Sprintf("%.3f", p.canSkipUntilS))
+	}
+	if lowLatency {
+		serverControl = append(serverControl, "PART-HOLD-BACK="+fmt.Sprintf("%.3f", p.partTargetDurS*PartHoldBackFactor))
+	}
+	if len(serverControl) > 0 {
+		buffer.WriteString("#EXT-X-SERVER-CONTROL:" + strings.Join(serverControl, ",") + "\n")
+	}
+
+	if lowLatency {
+		buffer.WriteString("#EXT-X-PART-INF:PART-TARGET=" + fmt.Sprintf("%.3f", p.partTargetDurS) + "\n")
+	}
 
 	if p.isIndependentSegments {
 		buffer.WriteString("#EXT-X-INDEPENDENT-SEGMENTS\n")
 	}
 
-	if p.initChunkDataFileName != "" {
-		chunkPath, _ := filepath.Rel(path.Dir(p.chunklistFileName), p.initChunkDataFileName)
-		buffer.WriteString("#EXT-X-MAP:URI=\"" + chunkPath + "\"\n")
+	if p.startFraction > 0 {
+		start := Start{TimeOffsetS: -p.startFraction * p.TotalDuration(), Precise: p.startPrecise}
+		buffer.WriteString(start.String())
 	}
 
-	for _, chunk := range p.chunks {
-		if chunk.IsDisco {
-			buffer.WriteString("#EXT-X-DISCONTINUITY\n")
+	buffer.WriteString(p.dateRangesString(ctx, headIndex, headIndex))
+
+	headMap := p.mapString(p.initChunkDataFileName, p.initByteRangeLength, p.initByteRangeOffset)
+	if mapIndex >= 0 && mapIndex < len(p.chunks) {
+		headMap = p.chunkMapString(p.chunks[mapIndex])
+	}
+	buffer.WriteString(headMap)
+
+	return buffer.String()
+}
+
+// chunkInitFileName Returns the init chunk that applies to a chunk
+func (p *Hls) chunkInitFileName(chunk Chunk) string {
+	if chunk.InitFileName != "" {
+		return chunk.InitFileName
+	}
+
+	return p.initChunkDataFileName
+}
+
+// chunkMapString Returns the #EXT-X-MAP line of the init chunk that applies to a chunk ("" if none)
+func (p *Hls) chunkMapString(chunk Chunk) string {
+	if chunk.InitFileName != "" {
+		return p.mapString(chunk.InitFileName, chunk.InitByteRangeLength, chunk.InitByteRangeOffset)
+	}
+
+	return p.mapString(p.initChunkDataFileName, p.initByteRangeLength, p.initByteRangeOffset)
+}
+
+// mapString Returns the #EXT-X-MAP line for an init chunk ("" if none), byteRangeLength 0 means whole file
+func (p *Hls) mapString(initFileName string, byteRangeLength int64, byteRangeOffset int64) string {
+	if initFileName == "" {
+		return ""
+	}
+
+	ret := "#EXT-X-MAP:URI=\"" + p.quotedURI(initFileName) + "\""
+	if byteRangeLength > 0 {
+		ret = ret + ",BYTERANGE=\"" + strconv.FormatInt(byteRangeLength, 10) + "@" + strconv.FormatInt(byteRangeOffset, 10) + "\""
+	}
+
+	return ret + "\n"
+}
+
+// chunkString Returns the tags and URI of the chunk at index, previous is the chunk written before (nil for the 1st one)
+func (p *Hls) chunkString(ctx renderContext, index int, previous *Chunk) string {
+	var buffer bytes.Buffer
+	chunk := p.chunks[index]
+
+	if p.segmentRenderer != nil {
+		handled, err := p.segmentRenderer(chunk, &buffer)
+		if err != nil {
+			p.log.Error("Error rendering chunk ", chunk.FileName, " with the segment renderer, using the default one. Error: ", err)
+		} else if handled {
+			return buffer.String()
 		}
-		buffer.WriteString("#EXTINF:" + fmt.Sprintf("%.8f", chunk.DurationS) + ",\n")
+		buffer.Reset()
+	}
+
+	if chunk.IsDisco {
+		buffer.WriteString("#EXT-X-DISCONTINUITY\n")
+	}
 
-		chunkPath, _ := filepath.Rel(path.Dir(p.chunklistFileName), chunk.FileName)
-		buffer.WriteString(chunkPath + "\n")
+	// Tags order: DISCONTINUITY, MAP, KEY, PROGRAM-DATE-TIME, BITRATE, SCTE-35 marker, PART, checksum, EXTINF
+	previousKeys := []Key(nil)
+	previousBitrateKbps := int64(0)
+	if previous != nil {
+		// The init is declared again after a format change discontinuity
+		formatDisco := p.discoOnFormatChange && chunk.IsDisco && formatChanged(*previous, chunk)
+		if mapStr := p.chunkMapString(chunk); mapStr != "" && (formatDisco || mapStr != p.chunkMapString(*previous)) {
+			buffer.WriteString(mapStr)
+		}
+		previousKeys = previous.Keys
+		previousBitrateKbps = previous.BitrateKbps
+	}
+	buffer.WriteString(keysString(previousKeys, chunk.Keys))
+	if !chunk.ProgramDateTime.IsZero() {
+		buffer.WriteString("#EXT-X-PROGRAM-DATE-TIME:" + chunk.ProgramDateTime.Format(p.programDateTimeFormat()) + "\n")
+	}
+	if chunk.BitrateKbps > 0 && chunk.BitrateKbps != previousBitrateKbps {
+		buffer.WriteString("#EXT-X-BITRATE:" + strconv.FormatInt(chunk.BitrateKbps, 10) + "\n")
+	}
+	buffer.WriteString(p.scte35String(chunk, index))
+	for _, part := range chunk.Parts {
+		buffer.WriteString(p.partString(part))
+	}
+	buffer.WriteString(p.checksumString(chunk))
+	buffer.WriteString(p.extinfString(ctx, chunk))
+
+	if chunk.InlineData != nil {
+		buffer.WriteString("data:" + InlineDataContentType + ";base64," + base64.StdEncoding.EncodeToString(chunk.InlineData) + "\n")
+	} else {
+		buffer.WriteString(p.chunkURI(chunk.FileName) + "\n")
+	}
+
+	return buffer.String()
+}
+
+// String write info to chunklist.m3u8
+func (p *Hls) String() string {
+	return p.render(p.newRenderContext(p.EffectiveVersion()), 0)
+}
+
+// render Returns the chunklist replacing the first skipped chunks by #EXT-X-SKIP (delta update)
+func (p *Hls) render(ctx renderContext, skipped int) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString(p.renderHeader(ctx, skipped, skipped))
+
+	if skipped > 0 {
+		buffer.WriteString("#EXT-X-SKIP:SKIPPED-SEGMENTS=" + strconv.Itoa(skipped) + "\n")
+	}
+
+	for i := skipped; i < len(p.chunks); i++ {
+		if i == skipped {
+			buffer.WriteString(p.chunkString(ctx, i, nil))
+		} else {
+			buffer.WriteString(p.dateRangesString(ctx, i, skipped))
+			buffer.WriteString(p.chunkString(ctx, i, &p.chunks[i-1]))
+		}
+	}
+
+	for _, part := range p.parts {
+		buffer.WriteString(p.partString(part))
+	}
+
+	if p.preloadHint != nil && !ctx.closed {
+		buffer.WriteString(p.preloadHintString(*p.preloadHint))
+	}
+
+	if ctx.closed {
+		buffer.WriteString("#EXT-X-ENDLIST\n")
+	}
+
+	return buffer.String()
+}
+
+// RenderReversed Returns the chunklist with the chunks newest first.
+// This is NOT a playable chunklist, it is only intended for editing / analysis tools
+func (p *Hls) RenderReversed() string {
+	var buffer bytes.Buffer
+
+	ctx := p.newRenderContext(p.EffectiveVersion())
+	buffer.WriteString(p.renderHeader(ctx, 0, len(p.chunks)-1))
+
+	for i := len(p.chunks) - 1; i >= 0; i-- {
+		if i > 0 {
+			buffer.WriteString(p.dateRangesString(ctx, i, 0))
+		}
+		if i == len(p.chunks)-1 {
+			buffer.WriteString(p.chunkString(ctx, i, nil))
+		} else {
+			buffer.WriteString(p.chunkString(ctx, i, &p.chunks[i+1]))
+		}
 	}
 
-	if p.isClosed {
+	if ctx.closed {
 		buffer.WriteString("#EXT-X-ENDLIST\n")
 	}
 
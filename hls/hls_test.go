@@ -1 +1,1695 @@
 package hls
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func newTestHls(manifestType ManifestTypes, slidingWindowSize int) Hls {
+	return New(logrus.New(), manifestType, 3, false, 4.0, slidingWindowSize, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+}
+
+func TestHlsInitChunkURIWithQuery(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetSegmentQuery("?token=abc")
+	h.SetInitChunk("results/init00000.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+
+	xpectedMap := "#EXT-X-MAP:URI=\"init00000.ts?token=abc\"\n"
+	if !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+
+	xpectedChunk := "\nchunk_00000.ts?token=abc\n"
+	if !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+}
+
+func TestHlsInitChunkURIWithBaseURL(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetSegmentBaseURL("https://cdn.example.com/live/")
+	h.SetSegmentQuery("token=abc")
+	h.SetInitChunk("results/init00000.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+
+	xpectedMap := "#EXT-X-MAP:URI=\"https://cdn.example.com/live/init00000.ts?token=abc\"\n"
+	if !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+
+	xpectedChunk := "\nhttps://cdn.example.com/live/chunk_00000.ts?token=abc\n"
+	if !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+}
+
+func TestHlsSegmentQueryExistingQuery(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetSegmentQuery("token=abc")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts?v=1", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+
+	xpectedChunk := "\nchunk_00000.ts?v=1&token=abc\n"
+	if !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+	xpectedChunk = "\nchunk_00001.ts?token=abc\n"
+	if !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+}
+
+func totalChunksDurationS(h Hls) float64 {
+	ret := 0.0
+	for _, chunk := range h.chunks {
+		ret = ret + chunk.DurationS
+	}
+
+	return ret
+}
+
+func TestHlsTruncateToDuration(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.SetInitChunk("results/init00000.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+
+	h.TruncateToDuration(10.0, false)
+
+	xpectedDurS := 8.0
+	if durS := totalChunksDurationS(h); durS != xpectedDurS {
+		t.Errorf("Retained duration is not correct, got %f, want %f", durS, xpectedDurS)
+	}
+
+	manifestStr := h.String()
+	if !strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY\n#EXTINF:4.00000000,\nchunk_00001.ts\n") {
+		t.Errorf("Discontinuity in the kept range is missing, got %s", manifestStr)
+	}
+	if !strings.Contains(manifestStr, "#EXT-X-MAP:URI=\"init00000.ts\"\n") {
+		t.Errorf("Init chunk is missing, got %s", manifestStr)
+	}
+	if strings.Contains(manifestStr, "chunk_00002.ts") {
+		t.Errorf("Crossing chunk should be dropped, got %s", manifestStr)
+	}
+}
+
+func TestHlsTruncateToDurationKeepCrossingChunk(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 4.0}, false)
+
+	h.TruncateToDuration(10.0, true)
+
+	xpectedDurS := 12.0
+	if durS := totalChunksDurationS(h); durS != xpectedDurS {
+		t.Errorf("Retained duration is not correct, got %f, want %f", durS, xpectedDurS)
+	}
+
+	manifestStr := h.String()
+	if !strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY\n") {
+		t.Errorf("Discontinuity in the kept range is missing, got %s", manifestStr)
+	}
+	if !strings.Contains(manifestStr, "#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-DISCONTINUITY-SEQUENCE:0\n") {
+		t.Errorf("Sequences should be preserved, got %s", manifestStr)
+	}
+}
+
+func TestHlsIndependentSegmentsRenderOnlyWhenSet(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-INDEPENDENT-SEGMENTS") {
+		t.Errorf("Independent segments should not be rendered, got %s", manifestStr)
+	}
+
+	h.SetIndependentSegments(true)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-INDEPENDENT-SEGMENTS\n") {
+		t.Errorf("Independent segments should be rendered, got %s", manifestStr)
+	}
+}
+
+func TestHlsIndependentSegmentsLongGOPWarning(t *testing.T) {
+	log, hook := logrustest.NewNullLogger()
+	h := New(log, LiveWindow, 3, true, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.2}, false)
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("Unexpected warning for a chunk close to target, got %d entries", len(hook.AllEntries()))
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 10.0}, false)
+	if entry := hook.LastEntry(); entry == nil || entry.Level != logrus.WarnLevel {
+		t.Errorf("Expected a long GOP warning, got %v", entry)
+	}
+}
+
+func TestHlsTargetDurationCeil(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.3}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-TARGETDURATION:5\n") {
+		t.Errorf("Target duration is not correct, got %s, want 5", manifestStr)
+	}
+}
+
+func TestHlsMonotonicTargetDuration(t *testing.T) {
+	for _, monotonic := range []bool{false, true} {
+		h := newTestHls(LiveWindow, 2)
+		h.SetMonotonicTargetDuration(monotonic)
+		h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 6.2}, false)
+		h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+		if targetDuration := h.targetDuration(); targetDuration != 7 {
+			t.Errorf("Target duration is not correct, got %d, want %d", targetDuration, 7)
+		}
+
+		// The longest chunk is evicted
+		h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+		h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 3.8}, false)
+
+		xpectedTargetDuration := int64(4)
+		if monotonic {
+			xpectedTargetDuration = 7
+		}
+		if targetDuration := h.targetDuration(); targetDuration != xpectedTargetDuration {
+			t.Errorf("Target duration (monotonic %t) is not correct, got %d, want %d", monotonic, targetDuration, xpectedTargetDuration)
+		}
+	}
+}
+
+func TestHlsMaxSegmentDurationFactor(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 3, false, 6.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+
+	// Disabled by default
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 60.0}, false); err != nil {
+		t.Errorf("Unexpected error adding chunk, got %v", err)
+	}
+
+	h.SetMaxSegmentDurationFactor(2.0)
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 60.0}, false); err != ErrSegmentTooLong {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrSegmentTooLong)
+	}
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 7.5}, false); err != nil {
+		t.Errorf("Unexpected error adding chunk, got %v", err)
+	}
+	if len(h.chunks) != 2 {
+		t.Errorf("Number of chunks is not correct, got %d, want %d", len(h.chunks), 2)
+	}
+}
+
+func TestHlsMinTargetDuration(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetMinTargetDuration(6.0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 2.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 2.5}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-TARGETDURATION:6\n") {
+		t.Errorf("Target duration is not correct, got %s, want 6", manifestStr)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 6.4}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-TARGETDURATION:7\n") {
+		t.Errorf("Target duration is not correct, got %s, want 7", manifestStr)
+	}
+}
+
+// slowWriter Writer that sleeps on each write and cancels a context after some writes
+type slowWriter struct {
+	buf          bytes.Buffer
+	delay        time.Duration
+	writes       int
+	cancelAfterN int
+	cancel       context.CancelFunc
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.writes++
+	if w.writes == w.cancelAfterN {
+		w.cancel()
+	}
+
+	return w.buf.Write(p)
+}
+
+func TestHlsWriteToContext(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	var buf bytes.Buffer
+	n, err := h.WriteToContext(context.Background(), &buf)
+	if err != nil || n != int64(len(h.String())) || buf.String() != h.String() {
+		t.Errorf("Write is not correct, got %d bytes (err: %v), want %d bytes", n, err, len(h.String()))
+	}
+}
+
+func TestHlsWriteToContextCanceled(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	w := &slowWriter{delay: time.Millisecond, cancelAfterN: 2, cancel: cancel}
+	n, err := h.WriteToContext(ctx, w)
+
+	if err != context.Canceled {
+		t.Errorf("Error is not correct, got %v, want %v", err, context.Canceled)
+	}
+	if n <= 0 || n >= int64(len(h.String())) || n != int64(w.buf.Len()) {
+		t.Errorf("Expected a partial write, got %d bytes of %d", n, len(h.String()))
+	}
+	if !strings.HasPrefix(h.String(), w.buf.String()) {
+		t.Errorf("Partial write is not a prefix of the chunklist, got %s", w.buf.String())
+	}
+}
+
+func TestHlsNormalizeDiscontinuitiesDoubleDisco(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 4.0}, false)
+
+	if removed := h.NormalizeDiscontinuities(); removed != 1 {
+		t.Errorf("Removed discontinuities is not correct, got %d, want %d", removed, 1)
+	}
+
+	if n := strings.Count(h.String(), "#EXT-X-DISCONTINUITY\n"); n != 1 {
+		t.Errorf("Discontinuities is not correct, got %d, want %d", n, 1)
+	}
+	if !h.chunks[1].IsDisco || h.chunks[2].IsDisco {
+		t.Errorf("Discontinuity should be kept in the first chunk of the boundary")
+	}
+	// The last chunk keeps its discontinuity sequence number (2)
+	if h.dseq != 1 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, 1)
+	}
+}
+
+func TestHlsNormalizeDiscontinuitiesLeadingDisco(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	if removed := h.NormalizeDiscontinuities(); removed != 1 {
+		t.Errorf("Removed discontinuities is not correct, got %d, want %d", removed, 1)
+	}
+
+	manifestStr := h.String()
+	if strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY\n") {
+		t.Errorf("Leading discontinuity should be removed, got %s", manifestStr)
+	}
+	// The chunks keep their discontinuity sequence number (1)
+	if !strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY-SEQUENCE:1\n") {
+		t.Errorf("Discontinuity sequence is not correct, got %s", manifestStr)
+	}
+}
+
+func TestHlsNormalizeDiscontinuitiesRun(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	for i := 0; i < 5; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0, IsDisco: true}, false)
+	}
+
+	// Window 2, 3, 4 all discontinuities, 2 evicted
+	if removed := h.NormalizeDiscontinuities(); removed != 2 {
+		t.Errorf("Removed discontinuities is not correct, got %d, want %d", removed, 2)
+	}
+
+	manifestStr := h.String()
+	if n := strings.Count(manifestStr, "#EXT-X-DISCONTINUITY\n"); n != 1 || !h.chunks[0].IsDisco {
+		t.Errorf("Discontinuities are not correct, got %d, want only the leading one", n)
+	}
+	// The last chunk keeps its discontinuity sequence number (2 + 3)
+	if !strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY-SEQUENCE:4\n") {
+		t.Errorf("Discontinuity sequence is not correct, got %s", manifestStr)
+	}
+}
+
+func TestHlsNormalizeDiscontinuitiesLeadingRun(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	for i := 0; i < 3; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0, IsDisco: true}, false)
+	}
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 4.0}, false)
+
+	// The run is collapsed in the leading discontinuity, that is dropped
+	if removed := h.NormalizeDiscontinuities(); removed != 3 {
+		t.Errorf("Removed discontinuities is not correct, got %d, want %d", removed, 3)
+	}
+	for i, chunk := range h.chunks {
+		if chunk.IsDisco {
+			t.Errorf("Chunk %d should not be a discontinuity", i)
+		}
+	}
+	if h.dseq != 3 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, 3)
+	}
+}
+
+func TestHlsDiscontinuitySequenceOnEviction(t *testing.T) {
+	h := newTestHls(LiveWindow, 2)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 4.0}, false)
+
+	// Discontinuity was evicted, so nothing to normalize
+	if removed := h.NormalizeDiscontinuities(); removed != 0 {
+		t.Errorf("Removed discontinuities is not correct, got %d, want %d", removed, 0)
+	}
+
+	manifestStr := h.String()
+	if !strings.Contains(manifestStr, "#EXT-X-MEDIA-SEQUENCE:2\n#EXT-X-DISCONTINUITY-SEQUENCE:1\n") {
+		t.Errorf("Sequences are not correct, got %s", manifestStr)
+	}
+}
+
+func TestHlsInlineDataURI(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, InlineData: []byte{0x47, 0x40, 0x00, 0x10}}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+
+	xpectedChunk := "#EXTINF:4.00000000,\ndata:video/mp2t;base64,R0AAEA==\n"
+	if !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Data URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+	if strings.Contains(manifestStr, "chunk_00000.ts") || !strings.Contains(manifestStr, "\nchunk_00001.ts\n") {
+		t.Errorf("Only inline chunks should use data URIs, got %s", manifestStr)
+	}
+}
+
+func TestHlsEstimateBandwidth(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, SizeBytes: 500000}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, SizeBytes: 1000000}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 2.0, SizeBytes: 250000}, false)
+
+	peakBps, averageBps := h.EstimateBandwidth()
+
+	xpectedPeakBps := int64(2000000)
+	if peakBps != xpectedPeakBps {
+		t.Errorf("Peak bandwidth is not correct, got %d, want %d", peakBps, xpectedPeakBps)
+	}
+
+	xpectedAverageBps := int64(1400000)
+	if averageBps != xpectedAverageBps {
+		t.Errorf("Average bandwidth is not correct, got %d, want %d", averageBps, xpectedAverageBps)
+	}
+}
+
+func TestHlsTargetDurationFractional(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 5.92}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-TARGETDURATION:6\n") {
+		t.Errorf("Integer target duration is not correct, got %s, want 6", manifestStr)
+	}
+
+	h.SetTargetDurationFractional(true)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-TARGETDURATION:6.0\n") {
+		t.Errorf("Fractional target duration is not correct, got %s, want 6.0", manifestStr)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 6.04}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-TARGETDURATION:6.1\n") {
+		t.Errorf("Fractional target duration is not correct, got %s, want 6.1", manifestStr)
+	}
+}
+
+// fakeClock Clock that advances one second on each call
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.t = c.t.Add(time.Second)
+	return c.t
+}
+
+func TestHlsMaxAge(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	// The delay starts at the 1st chunk, whatever the clock used when it is set
+	h.SetMaxAge(30 * time.Second)
+	h.SetClock(func() time.Time { return now })
+	now = now.Add(time.Minute)
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-ENDLIST") {
+		t.Errorf("Chunklist should not be ended before the 1st chunk, got %s", manifestStr)
+	}
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	now = now.Add(30 * time.Second)
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-ENDLIST") {
+		t.Errorf("Chunklist should not be ended before max age, got %s", manifestStr)
+	}
+
+	now = now.Add(time.Second)
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, "#EXT-X-ENDLIST\n") {
+		t.Errorf("Chunklist should be ended after max age, got %s", manifestStr)
+	}
+	if manifestStr := h.RenderReversed(); !strings.HasSuffix(manifestStr, "#EXT-X-ENDLIST\n") {
+		t.Errorf("Reversed chunklist should be ended after max age, got %s", manifestStr)
+	}
+
+	// Rendering does not change the state
+	h.SetMaxLineLength(1000)
+	h.Lint()
+	if stats := h.Stats(); stats.Closed {
+		t.Errorf("Chunklist should not be closed by a render")
+	}
+
+	// Once ended it stays closed
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, "#EXT-X-ENDLIST\n") {
+		t.Errorf("Chunklist should stay ended after a new chunk, got %s", manifestStr)
+	}
+	if stats := h.Stats(); !stats.Closed {
+		t.Errorf("Chunklist should be closed after max age")
+	}
+
+	h.ReOpen()
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-ENDLIST") {
+		t.Errorf("Chunklist should not be ended after reopening, got %s", manifestStr)
+	}
+}
+
+func TestHlsLastPublishTimeFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, path.Join(dir, "chunklist.m3u8"), "", HlsOutputModeFile, nil, "", "")
+	h.SetClock(clock.Now)
+
+	if !h.LastPublishTime().IsZero() {
+		t.Errorf("Last publish time should be zero before publishing, got %v", h.LastPublishTime())
+	}
+
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true)
+	first := h.LastPublishTime()
+
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0}, true)
+	second := h.LastPublishTime()
+
+	if first.IsZero() || !second.After(first) {
+		t.Errorf("Last publish time should advance, got %v then %v", first, second)
+	}
+
+	// Failed save does not update the time
+	h.chunklistFileName = path.Join(dir, "missing", "chunklist.m3u8")
+	if err := h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00002.ts"), DurationS: 4.0}, true); err == nil {
+		t.Errorf("Expected an error saving to a missing dir")
+	}
+	if h.LastPublishTime() != second {
+		t.Errorf("Last publish time should not change on failures, got %v, want %v", h.LastPublishTime(), second)
+	}
+}
+
+func TestHlsLastPublishTimeHTTP(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "chunklist.m3u8", "", HlsOutputModeHTTP, server.Client(), serverURL.Scheme, serverURL.Host)
+	h.SetClock(clock.Now)
+
+	if err := h.AddChunk(Chunk{FileName: "chunk_00000.ts", DurationS: 4.0}, true); err != nil {
+		t.Errorf("Unexpected error publishing, got %v", err)
+	}
+	first := h.LastPublishTime()
+	if first.IsZero() {
+		t.Errorf("Last publish time should be set after a successful publish")
+	}
+
+	status = http.StatusInternalServerError
+	if err := h.AddChunk(Chunk{FileName: "chunk_00001.ts", DurationS: 4.0}, true); err == nil {
+		t.Errorf("Expected an error publishing")
+	}
+	if h.LastPublishTime() != first {
+		t.Errorf("Last publish time should not change on failures, got %v, want %v", h.LastPublishTime(), first)
+	}
+}
+
+func TestHlsExtinfTrailingComma(t *testing.T) {
+	h := newTestHls(Vod, 0)
+
+	tests := []struct {
+		durationS     float64
+		xpectedExtinf string
+	}{
+		{0, "#EXTINF:0.00000000,\n"},
+		{0.000000001, "#EXTINF:0.00000000,\n"},
+		{0.00000001, "#EXTINF:0.00000001,\n"},
+		{0.5, "#EXTINF:0.50000000,\n"},
+	}
+
+	for _, test := range tests {
+		if extinf := h.extinfString(h.newRenderContext(h.EffectiveVersion()), Chunk{DurationS: test.durationS}); extinf != test.xpectedExtinf {
+			t.Errorf("EXTINF is not correct for %g, got %q, want %q", test.durationS, extinf, test.xpectedExtinf)
+		}
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 0}, false)
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXTINF:0.00000000,\nchunk_00000.ts\n") {
+		t.Errorf("Zero duration chunk is not correct, got %s", manifestStr)
+	}
+}
+
+func readFileString(t *testing.T, fileName string) string {
+	data, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		t.Fatalf("Error reading %s: %v", fileName, err)
+	}
+
+	return string(data)
+}
+
+func TestHlsBackupFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, chunklistFileName, "", HlsOutputModeFile, nil, "", "")
+	h.SetBackupFiles(3)
+
+	manifestStrs := make([]string, 0)
+	for i := 0; i < 5; i++ {
+		h.AddChunk(Chunk{FileName: path.Join(dir, fmt.Sprintf("chunk_%05d.ts", i)), DurationS: 4.0}, true)
+		manifestStrs = append(manifestStrs, h.String())
+	}
+
+	// Newest first
+	for n := 1; n <= 3; n++ {
+		if manifestStr := readFileString(t, fmt.Sprintf("%s.%d", chunklistFileName, n)); manifestStr != manifestStrs[len(manifestStrs)-n] {
+			t.Errorf("Backup %d is not correct, got %s, want %s", n, manifestStr, manifestStrs[len(manifestStrs)-n])
+		}
+	}
+	if _, err := os.Stat(chunklistFileName + ".4"); !os.IsNotExist(err) {
+		t.Errorf("Only 3 backups should be kept, got %v", err)
+	}
+	if manifestStr := readFileString(t, chunklistFileName); manifestStr != manifestStrs[len(manifestStrs)-1] {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, manifestStrs[len(manifestStrs)-1])
+	}
+}
+
+func TestHlsFileFlushInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	h := New(logrus.New(), Vod, 3, false, 4.0, 0, chunklistFileName, "", HlsOutputModeFile, nil, "", "")
+	h.SetClock(clock.Now)
+	h.SetFileFlushInterval(time.Minute)
+
+	// 1st save is written
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true)
+	firstManifestStr := h.String()
+
+	// Next saves are buffered
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0}, true)
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00002.ts"), DurationS: 4.0}, true)
+
+	if manifestStr := readFileString(t, chunklistFileName); manifestStr != firstManifestStr {
+		t.Errorf("Buffered chunklist should not be written yet, got %s, want %s", manifestStr, firstManifestStr)
+	}
+
+	if err := h.CloseManifest(true); err != nil {
+		t.Errorf("Unexpected error closing, got %v", err)
+	}
+
+	manifestStr := readFileString(t, chunklistFileName)
+	if manifestStr != h.String() {
+		t.Errorf("Chunklist is not correct after close, got %s, want %s", manifestStr, h.String())
+	}
+	if !strings.Contains(manifestStr, "chunk_00002.ts\n#EXT-X-ENDLIST\n") {
+		t.Errorf("Last update lost on close, got %s", manifestStr)
+	}
+}
+
+func TestHlsFileFlushIntervalElapsed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	h := New(logrus.New(), LiveEvent, 3, false, 4.0, 0, chunklistFileName, "", HlsOutputModeFile, nil, "", "")
+	h.SetClock(clock.Now)
+	h.SetFileFlushInterval(2 * time.Second)
+
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true)
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0}, true)
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00002.ts"), DurationS: 4.0}, true)
+
+	// The fake clock advances 1s per call, so the interval elapsed at the 3rd save
+	if manifestStr := readFileString(t, chunklistFileName); manifestStr != h.String() {
+		t.Errorf("Chunklist should be flushed after the interval, got %s, want %s", manifestStr, h.String())
+	}
+}
+
+func TestHlsFileFlushIntervalStalled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	h := New(logrus.New(), LiveEvent, 3, false, 4.0, 0, chunklistFileName, "", HlsOutputModeFile, nil, "", "")
+	h.SetClock(clock.Now)
+	h.SetFileFlushInterval(time.Minute)
+
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true)
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0}, true)
+
+	// The source stalls: nothing is written without a save until the caller flushes
+	clock.t = clock.t.Add(time.Hour)
+	if manifestStr := readFileString(t, chunklistFileName); strings.Contains(manifestStr, "chunk_00001.ts") {
+		t.Errorf("Buffered chunklist should not be written without a flush, got %s", manifestStr)
+	}
+
+	// Periodic flush
+	if err := h.Flush(); err != nil {
+		t.Errorf("Unexpected error flushing, got %v", err)
+	}
+	if manifestStr := readFileString(t, chunklistFileName); manifestStr != h.String() {
+		t.Errorf("Chunklist is not correct after the flush, got %s, want %s", manifestStr, h.String())
+	}
+
+	// Nothing pending, the next flush does not write
+	os.Remove(chunklistFileName)
+	if err := h.Flush(); err != nil {
+		t.Errorf("Unexpected error flushing, got %v", err)
+	}
+	if _, err := os.Stat(chunklistFileName); !os.IsNotExist(err) {
+		t.Errorf("Flush without pending update should not write, got %v", err)
+	}
+}
+
+func TestHlsRenderReversed(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 3.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 2.0}, false)
+	h.CloseManifest(false)
+
+	manifestStr := h.RenderReversed()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-TARGETDURATION:4
+#EXTINF:2.00000000,
+chunk_00002.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:3.00000000,
+chunk_00001.ts
+#EXTINF:4.00000000,
+chunk_00000.ts
+#EXT-X-ENDLIST
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Reversed manifest is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+
+	header := h.RenderHeader()
+	if !strings.HasPrefix(h.String(), header) || !strings.HasPrefix(manifestStr, header) {
+		t.Errorf("Header should be unchanged, got %s, want %s", manifestStr, header)
+	}
+}
+
+func TestHlsRenderReversedInitChange(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.SetHlsVersion(6)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0, InitFileName: "results/initA.mp4"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 4.0, InitFileName: "results/initB.mp4", IsDisco: true}, false)
+
+	// The header MAP is the one of the newest chunk, rendered first
+	xpectedChunks := `#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="initB.mp4"
+#EXT-X-DISCONTINUITY
+#EXTINF:4.00000000,
+chunk_00001.m4s
+#EXT-X-MAP:URI="initA.mp4"
+#EXTINF:4.00000000,
+chunk_00000.m4s
+`
+	if manifestStr := h.RenderReversed(); !strings.HasSuffix(manifestStr, xpectedChunks) {
+		t.Errorf("Reversed manifest is not correct, got %s, want %s", manifestStr, xpectedChunks)
+	}
+}
+
+func TestHlsHeadInitChunkAfterEviction(t *testing.T) {
+	h := newTestHls(LiveWindow, 2)
+	h.SetInitChunk("results/initA.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.SetInitChunk("results/initB.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0, IsDisco: true}, false)
+
+	manifestStr := h.String()
+	xpectedChunks := `#EXT-X-MAP:URI="initA.ts"
+#EXTINF:4.00000000,
+chunk_00001.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-MAP:URI="initB.ts"
+#EXTINF:4.00000000,
+chunk_00002.ts
+`
+	if !strings.HasSuffix(manifestStr, xpectedChunks) {
+		t.Errorf("Init chunks are not correct, got %s, want %s", manifestStr, xpectedChunks)
+	}
+
+	// Evict the last chunk that uses initA
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 4.0}, false)
+
+	manifestStr = h.String()
+	xpectedChunks = `#EXT-X-MAP:URI="initB.ts"
+#EXT-X-DISCONTINUITY
+#EXTINF:4.00000000,
+chunk_00002.ts
+#EXTINF:4.00000000,
+chunk_00003.ts
+`
+	if !strings.HasSuffix(manifestStr, xpectedChunks) {
+		t.Errorf("Top EXT-X-MAP should follow the head chunk, got %s, want %s", manifestStr, xpectedChunks)
+	}
+	if strings.Contains(manifestStr, "initA.ts") {
+		t.Errorf("Evicted init chunk should not be referenced, got %s", manifestStr)
+	}
+}
+
+func TestHlsRenderHeader(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetIndependentSegments(true)
+	h.SetInitChunk("results/init00000.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	header := h.RenderHeader()
+	xpectedHeader := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-TARGETDURATION:4
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MAP:URI="init00000.ts"
+`
+	if header != xpectedHeader {
+		t.Errorf("Header is not correct, got %s, want %s", header, xpectedHeader)
+	}
+
+	if !strings.HasPrefix(h.String(), header) {
+		t.Errorf("Header is not a prefix of the chunklist, got %s, want prefix %s", h.String(), header)
+	}
+}
+
+func TestHlsTotalDurationNoDrift(t *testing.T) {
+	h := newTestHls(Vod, 0)
+
+	numChunks := 100000
+	for i := 0; i < numChunks; i++ {
+		h.chunks = append(h.chunks, Chunk{FileName: "results/chunk.ts", DurationS: 0.1})
+	}
+
+	xpectedDurS := 10000.0
+	if durS := h.TotalDuration(); math.Abs(durS-xpectedDurS) > 1e-9 {
+		t.Errorf("Total duration drifted, got %.12f, want %.12f", durS, xpectedDurS)
+	}
+}
+
+func TestHlsAuditWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	var audit bytes.Buffer
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, path.Join(dir, "chunklist.m3u8"), "", HlsOutputModeFile, nil, "", "")
+	h.SetClock(clock.Now)
+	h.SetAuditWriter(&audit)
+
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true)
+	firstManifestStr := h.String()
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0}, true)
+	secondManifestStr := h.String()
+
+	xpectedAudit := "# 2020-01-01T00:00:01.000Z\n" + firstManifestStr + "# 2020-01-01T00:00:02.000Z\n" + secondManifestStr
+	if audit.String() != xpectedAudit {
+		t.Errorf("Audit is not correct, got %s, want %s", audit.String(), xpectedAudit)
+	}
+}
+
+func TestHlsTransferModes(t *testing.T) {
+	transferModes := make([]TransferModes, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TransferEncoding) > 0 && r.TransferEncoding[0] == "chunked" {
+			transferModes = append(transferModes, TransferModeChunked)
+		} else if r.ContentLength > 0 {
+			transferModes = append(transferModes, TransferModeContentLength)
+		}
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	h := New(logrus.New(), LiveEvent, 3, false, 4.0, 3, "chunklist.m3u8", "", HlsOutputModeHTTP, server.Client(), serverURL.Scheme, serverURL.Host)
+	h.SetPartTargetDuration(2.0)
+	h.AddPart(Part{FileName: "chunk_00000.0.ts", DurationS: 2.0}, true)
+	h.AddChunk(Chunk{FileName: "chunk_00000.ts", DurationS: 4.0}, true)
+
+	h.SetTransferModes(TransferModeChunked, TransferModeContentLength)
+	h.AddPart(Part{FileName: "chunk_00001.0.ts", DurationS: 2.0}, true)
+	h.AddChunk(Chunk{FileName: "chunk_00001.ts", DurationS: 4.0}, true)
+
+	xpectedTransferModes := []TransferModes{TransferModeChunked, TransferModeContentLength, TransferModeContentLength, TransferModeChunked}
+	if len(transferModes) != len(xpectedTransferModes) {
+		t.Fatalf("Number of publishes is not correct, got %d, want %d", len(transferModes), len(xpectedTransferModes))
+	}
+	for i, xpectedTransferMode := range xpectedTransferModes {
+		if transferModes[i] != xpectedTransferMode {
+			t.Errorf("Transfer mode of publish %d is not correct, got %d, want %d", i, transferModes[i], xpectedTransferMode)
+		}
+	}
+}
+
+func TestHlsOmitZeroMediaSequence(t *testing.T) {
+	vod := newTestHls(Vod, 0)
+	vod.SetOmitZeroMediaSequence(true)
+	vod.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if manifestStr := vod.String(); strings.Contains(manifestStr, "#EXT-X-MEDIA-SEQUENCE") {
+		t.Errorf("#EXT-X-MEDIA-SEQUENCE should be omitted in VOD, got %s", manifestStr)
+	}
+
+	live := newTestHls(LiveWindow, 3)
+	live.SetOmitZeroMediaSequence(true)
+	live.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if manifestStr := live.String(); !strings.Contains(manifestStr, "#EXT-X-MEDIA-SEQUENCE:0\n") {
+		t.Errorf("#EXT-X-MEDIA-SEQUENCE should be present in live, got %s", manifestStr)
+	}
+}
+
+func TestHlsIntegerDurations(t *testing.T) {
+	h := New(logrus.New(), Vod, 2, false, 6.0, 0, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	h.SetIntegerDurations(true)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 6.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 5.0}, false)
+
+	manifestStr := h.String()
+	if !strings.Contains(manifestStr, "#EXTINF:6,\nchunk_00000.ts\n#EXTINF:5,\nchunk_00001.ts\n") {
+		t.Errorf("Integer durations are not correct, got %s", manifestStr)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error for integer durations in version 2, got %v", err)
+	}
+
+	// A fractional duration disables integer durations
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 5.5}, false)
+
+	manifestStr = h.String()
+	if !strings.Contains(manifestStr, "#EXTINF:6.00000000,\nchunk_00000.ts\n#EXTINF:5.00000000,\nchunk_00001.ts\n#EXTINF:5.50000000,\n") {
+		t.Errorf("Fractional durations are not correct, got %s", manifestStr)
+	}
+	if err := h.Validate(); err == nil {
+		t.Errorf("Expected a version error for fractional durations in version 2")
+	}
+}
+
+func TestHlsSlidingWindowSizeGuard(t *testing.T) {
+	for _, slidingWindowSize := range []int{0, -3} {
+		log, hook := logrustest.NewNullLogger()
+		h := New(log, LiveWindow, 3, false, 4.0, slidingWindowSize, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+
+		if len(hook.AllEntries()) != 1 || hook.LastEntry().Level != logrus.WarnLevel {
+			t.Errorf("Expected a warning for window size %d, got %d entries", slidingWindowSize, len(hook.AllEntries()))
+		}
+
+		h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+		h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+		if len(h.chunks) != MinSlidingWindowSize {
+			t.Errorf("Number of chunks is not correct for window size %d, got %d, want %d", slidingWindowSize, len(h.chunks), MinSlidingWindowSize)
+		}
+	}
+
+	// Not a window, no guard
+	log, hook := logrustest.NewNullLogger()
+	New(log, Vod, 3, false, 4.0, 0, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("Unexpected warning for VOD, got %d entries", len(hook.AllEntries()))
+	}
+}
+
+func TestHlsNilLogger(t *testing.T) {
+	// Falls back to the standard logger for the window size warning
+	h := New(nil, LiveWindow, 3, false, 4.0, 0, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+
+	if h.log != logrus.StandardLogger() || h.slidingWindowSize != MinSlidingWindowSize {
+		t.Errorf("Nil logger is not handled, got window size %d", h.slidingWindowSize)
+	}
+}
+
+func TestHlsAbsoluteURIs(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "live/chunklist.m3u8", "live/init00000.ts", HlsOutputModeHTTP, nil, "https", "cdn.example.com:8443")
+	h.SetSegmentBaseURL("https://ignored.example.com/")
+	h.SetAbsoluteURIs(true)
+	h.AddChunk(Chunk{FileName: "live/chunk_00000.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+
+	xpectedMap := "#EXT-X-MAP:URI=\"https://cdn.example.com:8443/live/init00000.ts\"\n"
+	if !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+	xpectedChunk := "\nhttps://cdn.example.com:8443/live/chunk_00000.ts\n"
+	if !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+}
+
+func TestHlsBeforeAdd(t *testing.T) {
+	errTooBig := errors.New("chunk too big")
+
+	h := newTestHls(LiveWindow, 3)
+	h.SetBeforeAdd(func(chunk *Chunk) error {
+		if chunk.SizeBytes > 1000 {
+			return errTooBig
+		}
+		chunk.DurationS = math.Round(chunk.DurationS*1000) / 1000
+		return nil
+	})
+
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, SizeBytes: 2000}, false); err != errTooBig {
+		t.Errorf("Error is not correct, got %v, want %v", err, errTooBig)
+	}
+	if len(h.chunks) != 0 {
+		t.Errorf("Number of chunks is not correct, got %d, want %d", len(h.chunks), 0)
+	}
+
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0004, SizeBytes: 500}, false); err != nil {
+		t.Errorf("Unexpected error adding chunk, got %v", err)
+	}
+	if len(h.chunks) != 1 || h.chunks[0].DurationS != 4.0 {
+		t.Errorf("Chunks are not correct, got %v, want 1 chunk of %f", h.chunks, 4.0)
+	}
+}
+
+func TestHlsMediaSequenceFromFileName(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetMediaSequenceFromFileName(regexp.MustCompile(`^seg_(\d+)\.ts$`))
+	h.AddChunk(Chunk{FileName: "results/seg_000123.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/seg_000124.ts", DurationS: 4.0}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-MEDIA-SEQUENCE:123\n") {
+		t.Errorf("Media sequence is not correct, got %s, want %d", manifestStr, 123)
+	}
+
+	// Not matching filename falls back to the counted media sequence
+	h.AddChunk(Chunk{FileName: "results/seg_000125.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/seg_000126.ts", DurationS: 4.0}, false)
+	h.chunks[0].FileName = "results/other.ts"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-MEDIA-SEQUENCE:1\n") {
+		t.Errorf("Media sequence is not correct, got %s, want %d", manifestStr, 1)
+	}
+
+	h.SetMediaSequenceFromFileName(nil)
+	h.chunks[0].FileName = "results/seg_000124.ts"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-MEDIA-SEQUENCE:1\n") {
+		t.Errorf("Media sequence is not correct, got %s, want %d", manifestStr, 1)
+	}
+}
+
+func TestHlsBitrateTagsOrder(t *testing.T) {
+	pdt := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	h.SetKeys(Key{Method: "AES-128", URI: "key1.bin"})
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, ProgramDateTime: pdt, BitrateKbps: 2500}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, BitrateKbps: 2500}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0, ProgramDateTime: pdt.Add(time.Minute), IsDisco: true, BitrateKbps: 1800}, false)
+
+	manifestStr := h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-TARGETDURATION:4
+#EXT-X-KEY:METHOD=AES-128,URI="key1.bin"
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00.000Z
+#EXT-X-BITRATE:2500
+#EXTINF:4.00000000,
+chunk_00000.ts
+#EXTINF:4.00000000,
+chunk_00001.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:01:00.000Z
+#EXT-X-BITRATE:1800
+#EXTINF:4.00000000,
+chunk_00002.ts
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestHlsBitrateUnknownInherits(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, BitrateKbps: 2500}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0, BitrateKbps: 2500}, false)
+
+	// The unknown bitrate renders no tag, the chunk after it repeats the value
+	xpectedChunks := `#EXT-X-BITRATE:2500
+#EXTINF:4.00000000,
+chunk_00000.ts
+#EXTINF:4.00000000,
+chunk_00001.ts
+#EXT-X-BITRATE:2500
+#EXTINF:4.00000000,
+chunk_00002.ts
+`
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, xpectedChunks) {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedChunks)
+	}
+}
+
+func TestHlsSegmentRenderer(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetSegmentRenderer(func(chunk Chunk, w io.Writer) (bool, error) {
+		if chunk.FileName == "results/chunk_00001.ts" {
+			_, err := io.WriteString(w, "#EXT-X-CUE-OUT:DURATION=4\n#EXTINF:4.0,ad\nhttps://ads.example.com/ad.ts\n")
+			return true, err
+		}
+		if chunk.FileName == "results/chunk_00002.ts" {
+			io.WriteString(w, "#PARTIAL\n")
+			return true, errors.New("render error")
+		}
+		return false, nil
+	})
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.00000000,
+chunk_00000.ts
+#EXT-X-CUE-OUT:DURATION=4
+#EXTINF:4.0,ad
+https://ads.example.com/ad.ts
+#EXTINF:4.00000000,
+chunk_00002.ts
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestHlsURICase(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetHlsVersion(HlsVersionMap)
+	h.SetSegmentQuery("Token=AbC")
+	h.SetInitChunk("results/Init00000.mp4")
+	h.AddChunk(Chunk{FileName: "results/Chunk_00000.M4S", DurationS: 4.0}, false)
+
+	xpectedURIs := map[URICaseModes][]string{
+		URICasePreserve: {"#EXT-X-MAP:URI=\"Init00000.mp4?Token=AbC\"\n", "\nChunk_00000.M4S?Token=AbC\n"},
+		URICaseLower:    {"#EXT-X-MAP:URI=\"init00000.mp4?Token=AbC\"\n", "\nchunk_00000.m4s?Token=AbC\n"},
+		URICaseUpper:    {"#EXT-X-MAP:URI=\"INIT00000.MP4?Token=AbC\"\n", "\nCHUNK_00000.M4S?Token=AbC\n"},
+	}
+	for uriCase, xpectedURIs := range xpectedURIs {
+		h.SetURICase(uriCase)
+		manifestStr := h.String()
+		for _, xpectedURI := range xpectedURIs {
+			if !strings.Contains(manifestStr, xpectedURI) {
+				t.Errorf("URI (case mode %d) is not correct, got %s, want %s", uriCase, manifestStr, xpectedURI)
+			}
+		}
+	}
+}
+
+func TestHlsStartFraction(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.SetStartFraction(0.6, true)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	xpectedStart := "#EXT-X-START:TIME-OFFSET=-4.800,PRECISE=YES\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedStart) {
+		t.Errorf("EXT-X-START is not correct, got %s, want %s", manifestStr, xpectedStart)
+	}
+
+	// Scales with the window duration
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 2.0}, false)
+	xpectedStart = "#EXT-X-START:TIME-OFFSET=-6.000,PRECISE=YES\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedStart) {
+		t.Errorf("EXT-X-START is not correct, got %s, want %s", manifestStr, xpectedStart)
+	}
+
+	// Clamped to the whole window
+	h.SetStartFraction(1.5, false)
+	xpectedStart = "#EXT-X-START:TIME-OFFSET=-10.000\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedStart) {
+		t.Errorf("EXT-X-START is not correct, got %s, want %s", manifestStr, xpectedStart)
+	}
+
+	h.SetStartFraction(0, false)
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-START") {
+		t.Errorf("EXT-X-START should not be written, got %s", manifestStr)
+	}
+}
+
+func TestHlsProgramDateTimeOffsetForm(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, ProgramDateTime: time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, ProgramDateTime: time.Date(2020, 1, 1, 12, 0, 4, 0, time.FixedZone("CEST", 2*3600))}, false)
+
+	xpectedPDTs := map[bool][]string{
+		false: {"#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00.000Z\n", "#EXT-X-PROGRAM-DATE-TIME:2020-01-01T12:00:04.000+02:00\n"},
+		true:  {"#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00.000+00:00\n", "#EXT-X-PROGRAM-DATE-TIME:2020-01-01T12:00:04.000+02:00\n"},
+	}
+	for offsetForm, xpectedPDTs := range xpectedPDTs {
+		h.SetProgramDateTimeOffsetForm(offsetForm)
+		manifestStr := h.String()
+		for _, xpectedPDT := range xpectedPDTs {
+			if !strings.Contains(manifestStr, xpectedPDT) {
+				t.Errorf("Program date time (offset form %t) is not correct, got %s, want %s", offsetForm, manifestStr, xpectedPDT)
+			}
+		}
+	}
+}
+
+func TestHlsParentURIMode(t *testing.T) {
+	newParentHls := func(parentURIMode ParentURIModes) Hls {
+		h := New(logrus.New(), LiveWindow, HlsVersionMap, false, 4.0, 3, "live/720p/chunklist.m3u8", "live/init00000.mp4", HlsOutputModeNone, nil, "https", "cdn.example.com")
+		h.SetParentURIMode(parentURIMode)
+		h.AddChunk(Chunk{FileName: "live/720p/chunk_00000.m4s", DurationS: 4.0}, false)
+		return h
+	}
+
+	h := newParentHls(ParentURIAllow)
+	xpectedMap := "#EXT-X-MAP:URI=\"../init00000.mp4\"\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error allowing parent URIs, got %v", err)
+	}
+
+	// Only the URIs above the chunklist directory are made absolute
+	h = newParentHls(ParentURIAbsolute)
+	xpectedMap = "#EXT-X-MAP:URI=\"https://cdn.example.com/live/init00000.mp4\"\n"
+	manifestStr := h.String()
+	if !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+	if !strings.Contains(manifestStr, "\nchunk_00000.m4s\n") {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, "chunk_00000.m4s")
+	}
+
+	h = newParentHls(ParentURIReject)
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "URI ../init00000.mp4 is above the chunklist directory") {
+		t.Errorf("Expected a parent URI error, got %v", err)
+	}
+
+	// The served URIs are checked, not the disk paths
+	h = newParentHls(ParentURIReject)
+	h.SetServePath("live", "/chunklist.m3u8")
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error with served URIs below the chunklist, got %v", err)
+	}
+
+	s := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	s.SetParentURIMode(ParentURIReject)
+	s.SetServePath("results", "/live/720p/chunklist.m3u8")
+	s.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	if err := s.Validate(); err == nil || !strings.Contains(err.Error(), "URI ../../chunk_00000.ts is above the chunklist directory") {
+		t.Errorf("Expected a parent URI error, got %v", err)
+	}
+}
+
+func TestHlsSplitAtDiscontinuities(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.SetHlsVersion(HlsVersionMap)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0, InitFileName: "results/init_a.mp4"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 4.0, InitFileName: "results/init_a.mp4"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.m4s", DurationS: 4.0, InitFileName: "results/init_b.mp4", IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 4.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00004.ts", DurationS: 4.0}, false)
+
+	subs := h.SplitAtDiscontinuities()
+
+	xpectedChunks := [][]string{{"chunk_00000.m4s", "chunk_00001.m4s"}, {"chunk_00002.m4s"}, {"chunk_00003.ts", "chunk_00004.ts"}}
+	xpectedMaps := []string{"#EXT-X-MAP:URI=\"init_a.mp4\"\n", "#EXT-X-MAP:URI=\"init_b.mp4\"\n", ""}
+	if len(subs) != len(xpectedChunks) {
+		t.Fatalf("Number of chunklists is not correct, got %d, want %d", len(subs), len(xpectedChunks))
+	}
+
+	for i, sub := range subs {
+		if err := sub.Validate(); err != nil {
+			t.Errorf("Chunklist %d is not valid, got %v", i, err)
+		}
+
+		manifestStr := sub.String()
+		if strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY\n") || !strings.HasSuffix(manifestStr, "#EXT-X-ENDLIST\n") {
+			t.Errorf("Chunklist %d should be a closed VOD without discontinuities, got %s", i, manifestStr)
+		}
+		if xpectedMaps[i] != "" && !strings.Contains(manifestStr, xpectedMaps[i]) {
+			t.Errorf("EXT-X-MAP of chunklist %d is not correct, got %s, want %s", i, manifestStr, xpectedMaps[i])
+		}
+		if strings.Count(manifestStr, "#EXTINF:") != len(xpectedChunks[i]) {
+			t.Errorf("Number of chunks of chunklist %d is not correct, got %s, want %v", i, manifestStr, xpectedChunks[i])
+		}
+		for _, xpectedChunk := range xpectedChunks[i] {
+			if !strings.Contains(manifestStr, "\n"+xpectedChunk+"\n") {
+				t.Errorf("Chunk %s not found in chunklist %d, got %s", xpectedChunk, i, manifestStr)
+			}
+		}
+	}
+
+	// The original chunklist is not modified
+	if !h.chunks[2].IsDisco || len(h.chunks) != 5 {
+		t.Errorf("Original chunklist should not change")
+	}
+}
+
+func TestHlsSplitAtDiscontinuitiesSettings(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.SetMonotonicTargetDuration(true)
+	h.SetMaxSegmentDurationFactor(1.5)
+	h.SetStartFraction(0.5, true)
+	h.SetSkipEmptyFileName(true)
+	h.SetDiscontinuityOnFormatChange(true)
+	h.SetMinVodSegments(2)
+	h.SetPartTargetDuration(1.0)
+	h.SetLowLatency(true)
+	h.SetPartRetentionSegments(2)
+	h.SetMaxParts(10)
+	h.SetClampPartDurations(true)
+	h.SetMediaSequenceFromFileName(regexp.MustCompile(`chunk_(\d+)\.ts$`))
+	h.SetFileFlushInterval(time.Second)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, IsDisco: true}, false)
+
+	subs := h.SplitAtDiscontinuities()
+	if len(subs) != 2 {
+		t.Fatalf("Number of chunklists is not correct, got %d, want %d", len(subs), 2)
+	}
+
+	sub := subs[1]
+	if sub.monotonicTargetDur != h.monotonicTargetDur || sub.maxSegmentDurFactor != h.maxSegmentDurFactor ||
+		sub.startFraction != h.startFraction || sub.startPrecise != h.startPrecise ||
+		sub.skipEmptyFileName != h.skipEmptyFileName || sub.discoOnFormatChange != h.discoOnFormatChange ||
+		sub.minVodSegments != h.minVodSegments || sub.partTargetDurS != h.partTargetDurS ||
+		sub.lowLatency != h.lowLatency || sub.partRetentionSegments != h.partRetentionSegments ||
+		sub.maxParts != h.maxParts || sub.clampPartDurations != h.clampPartDurations ||
+		sub.mseqFileNameRegexp != h.mseqFileNameRegexp || sub.fileFlushInterval != h.fileFlushInterval {
+		t.Errorf("Settings are not correct, got %+v, want %+v", sub, h)
+	}
+
+	xpectedMseq := "#EXT-X-MEDIA-SEQUENCE:1\n"
+	if manifestStr := sub.String(); !strings.Contains(manifestStr, xpectedMseq) {
+		t.Errorf("Media sequence is not correct, got %s, want %s", manifestStr, xpectedMseq)
+	}
+}
+
+func TestHlsSplitAtDiscontinuitiesPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls-split")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := New(logrus.New(), Vod, 3, false, 4.0, 0, path.Join(dir, "chunklist.m3u8"), "", HlsOutputModeFile, nil, "", "")
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0, IsDisco: true}, false)
+
+	subs := h.SplitAtDiscontinuities()
+	if len(subs) != 2 {
+		t.Fatalf("Number of chunklists is not correct, got %d, want %d", len(subs), 2)
+	}
+
+	for i := range subs {
+		if err := subs[i].CloseManifest(true); err != nil {
+			t.Errorf("Unexpected error publishing chunklist %d, got %v", i, err)
+		}
+	}
+
+	for i, sub := range subs {
+		xpectedFileName := path.Join(dir, fmt.Sprintf("chunklist_%d.m3u8", i+1))
+		if manifestStr := readFileString(t, xpectedFileName); manifestStr != sub.String() {
+			t.Errorf("Chunklist %d is not correct, got %s, want %s", i, manifestStr, sub.String())
+		}
+	}
+	if _, err := os.Stat(path.Join(dir, "chunklist.m3u8")); !os.IsNotExist(err) {
+		t.Errorf("Original chunklist should not be written, got %v", err)
+	}
+}
+
+func TestHlsEmptyFileName(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+
+	if err := h.AddChunk(Chunk{DurationS: 4.0}, false); err != ErrChunkEmptyFileName {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrChunkEmptyFileName)
+	}
+	if len(h.chunks) != 0 {
+		t.Errorf("Chunk with empty filename should not be added, got %d chunks", len(h.chunks))
+	}
+
+	log, hook := logrustest.NewNullLogger()
+	h = New(log, LiveWindow, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	h.SetSkipEmptyFileName(true)
+
+	if err := h.AddChunk(Chunk{DurationS: 4.0}, false); err != nil {
+		t.Errorf("Unexpected error skipping the chunk, got %v", err)
+	}
+	if len(h.chunks) != 0 || len(hook.AllEntries()) != 1 {
+		t.Errorf("Chunk with empty filename should be skipped with a warning, got %d chunks and %d log entries", len(h.chunks), len(hook.AllEntries()))
+	}
+
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false); err != nil || len(h.chunks) != 1 {
+		t.Errorf("Valid chunk should be added, got %v and %d chunks", err, len(h.chunks))
+	}
+}
+
+func TestHlsRoundDurationsToMs(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 6.0166667}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXTINF:6.01666670,\n") {
+		t.Errorf("Duration should not be rounded by default, got %s", manifestStr)
+	}
+
+	h.SetRoundDurationsToMs(true)
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXTINF:6.017,\n") {
+		t.Errorf("Duration is not rounded to ms, got %s, want 6.017", manifestStr)
+	}
+
+	// Same option as the nearest rounding to 3 digits, the last call wins
+	h.SetDurationRounding(DurationRoundingFloor, 3)
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXTINF:6.016,\n") {
+		t.Errorf("Duration is not rounded down, got %s, want 6.016", manifestStr)
+	}
+
+	h.SetRoundDurationsToMs(false)
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXTINF:6.01666670,\n") {
+		t.Errorf("Duration should not be rounded once disabled, got %s", manifestStr)
+	}
+}
+
+func TestHlsDurationRounding(t *testing.T) {
+	xpectedExtinfs := map[DurationRoundingModes]string{
+		DurationRoundingFloor:   "#EXTINF:6.005,\n",
+		DurationRoundingCeil:    "#EXTINF:6.006,\n",
+		DurationRoundingNearest: "#EXTINF:6.006,\n",
+	}
+
+	for mode, xpectedExtinf := range xpectedExtinfs {
+		h := newTestHls(LiveWindow, 3)
+		h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 6.0055}, false)
+		h.SetDurationRounding(mode, 3)
+
+		if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedExtinf) {
+			t.Errorf("Duration with rounding %d is not correct, got %s, want %s", mode, manifestStr, xpectedExtinf)
+		}
+		if totalDurationS := h.TotalDuration(); totalDurationS != 6.0055 {
+			t.Errorf("Total duration with rounding %d is not correct, got %f, want %f", mode, totalDurationS, 6.0055)
+		}
+	}
+}
+
+func TestHlsServePath(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "results/www/live/stream/chunklist.m3u8", "results/www/live/stream/init00000.ts", HlsOutputModeNone, nil, "", "")
+	h.AddChunk(Chunk{FileName: "results/www/live/stream/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "\nchunk_00000.ts\n") {
+		t.Errorf("Chunk URI is not correct, got %s, want chunk_00000.ts", manifestStr)
+	}
+
+	// Served from the web root
+	h.SetServePath("results/www", "/chunklist.m3u8")
+	manifestStr := h.String()
+
+	xpectedMap := "#EXT-X-MAP:URI=\"live/stream/init00000.ts\"\n"
+	if !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+	xpectedChunk := "\nlive/stream/chunk_00000.ts\n"
+	if !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+
+	// Served from a sibling directory
+	h.SetServePath("results/www", "/playlists/chunklist.m3u8")
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "\n../live/stream/chunk_00000.ts\n") {
+		t.Errorf("Chunk URI is not correct, got %s, want ../live/stream/chunk_00000.ts", manifestStr)
+	}
+}
+
+func TestHlsServePathInvalid(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	// A relative serve path is refused
+	if err := h.SetServePath("results", "chunklist.m3u8"); err != ErrServePathNotRooted {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrServePathNotRooted)
+	}
+	xpectedChunk := "#EXTINF:4.00000000,\nchunk_00000.ts\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+
+	// A chunk outside of the served root keeps its disk relative URI
+	if err := h.SetServePath("results/www", "/chunklist.m3u8"); err != nil {
+		t.Fatalf("Unexpected error setting the serve path, got %v", err)
+	}
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedChunk) {
+		t.Errorf("Chunk URI is not correct, got %s, want %s", manifestStr, xpectedChunk)
+	}
+}
+
+func TestHlsReOpen(t *testing.T) {
+	log, hook := logrustest.NewNullLogger()
+	h := New(log, LiveEvent, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	// Closing twice writes ENDLIST once
+	h.CloseManifest(false)
+	h.CloseManifest(false)
+	if count := strings.Count(h.String(), "#EXT-X-ENDLIST"); count != 1 {
+		t.Errorf("Number of #EXT-X-ENDLIST is not correct, got %d, want 1", count)
+	}
+
+	h.ReOpen()
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+	if strings.Contains(manifestStr, "#EXT-X-ENDLIST") {
+		t.Errorf("#EXT-X-ENDLIST should be removed after reopening, got %s", manifestStr)
+	}
+	if !strings.HasSuffix(manifestStr, "#EXTINF:4.00000000,\nchunk_00001.ts\n") {
+		t.Errorf("Chunk added after reopening is not correct, got %s", manifestStr)
+	}
+	if len(hook.AllEntries()) != 1 || hook.LastEntry().Level != logrus.WarnLevel {
+		t.Errorf("Expected a warning reopening, got %d entries", len(hook.AllEntries()))
+	}
+
+	// Reopening an open chunklist does nothing
+	h.ReOpen()
+	if len(hook.AllEntries()) != 1 {
+		t.Errorf("Unexpected warning reopening an open chunklist, got %d entries", len(hook.AllEntries()))
+	}
+}
+
+func TestHlsCompact(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.CloseManifest(false)
+
+	manifestStr := h.String()
+	for _, xpectedTag := range []string{"#EXT-X-MEDIA-SEQUENCE:0\n", "#EXT-X-DISCONTINUITY-SEQUENCE:0\n"} {
+		if !strings.Contains(manifestStr, xpectedTag) {
+			t.Errorf("Tag %s not found in non compact chunklist, got %s", xpectedTag, manifestStr)
+		}
+	}
+
+	h.SetCompact(true)
+	manifestStr = h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-PLAYLIST-TYPE:VOD
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.00000000,
+chunk_00000.ts
+#EXT-X-ENDLIST
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Compact chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error validating the compact chunklist, got %v", err)
+	}
+
+	// Parsing the compact chunklist gives the same sequences
+	parsed, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8"})
+	if err != nil || parsed.mseq != 0 || parsed.dseq != 0 {
+		t.Errorf("Compact chunklist parse is not correct, got %v, mseq %d, dseq %d", err, parsed.mseq, parsed.dseq)
+	}
+}
+
+func TestHlsMinVodSegments(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.SetMinVodSegments(2)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if err := h.CloseManifest(false); err != ErrVodTooFewSegments {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrVodTooFewSegments)
+	}
+	if strings.Contains(h.String(), "#EXT-X-ENDLIST") {
+		t.Errorf("#EXT-X-ENDLIST should not be written below the minimum")
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	if err := h.CloseManifest(false); err != nil {
+		t.Errorf("Unexpected error closing at the minimum, got %v", err)
+	}
+	if !strings.HasSuffix(h.String(), "#EXT-X-ENDLIST\n") {
+		t.Errorf("#EXT-X-ENDLIST should be written at the minimum")
+	}
+}
+
+func TestHlsSegmentBaseURLSlashes(t *testing.T) {
+	tests := []struct {
+		baseURL  string
+		fileName string
+	}{
+		{"https://cdn.example.com/base", "chunk_00000.ts"},
+		{"https://cdn.example.com/base/", "chunk_00000.ts"},
+		{"https://cdn.example.com/base", "/chunk_00000.ts"},
+		{"https://cdn.example.com/base/", "/chunk_00000.ts"},
+		{"https://cdn.example.com/base//", "chunk_00000.ts"},
+		{"https://cdn.example.com/base//", "//chunk_00000.ts"},
+	}
+
+	xpectedChunk := "\nhttps://cdn.example.com/base/chunk_00000.ts\n"
+	for _, test := range tests {
+		h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+		h.SetSegmentBaseURL(test.baseURL)
+		h.AddChunk(Chunk{FileName: test.fileName, DurationS: 4.0}, false)
+
+		if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedChunk) {
+			t.Errorf("Chunk URI for %s and %s is not correct, got %s, want %s", test.baseURL, test.fileName, manifestStr, xpectedChunk)
+		}
+	}
+}
+
+func TestHlsDiscontinuityOnFormatChange(t *testing.T) {
+	h := newTestHls(LiveEvent, 3)
+	h.SetHlsVersion(HlsVersionMap)
+	h.SetDiscontinuityOnFormatChange(true)
+	h.SetInitChunk("results/init00000.mp4")
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0, Codecs: "avc1.64001f", Resolution: "1280x720"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 4.0, Codecs: "avc1.64001f", Resolution: "1280x720"}, false)
+	// Unknown format never triggers a discontinuity
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.m4s", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.m4s", DurationS: 4.0, Codecs: "avc1.64001f", Resolution: "1920x1080"}, false)
+
+	manifestStr := h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="init00000.mp4"
+#EXTINF:4.00000000,
+chunk_00000.m4s
+#EXTINF:4.00000000,
+chunk_00001.m4s
+#EXTINF:4.00000000,
+chunk_00002.m4s
+#EXTINF:4.00000000,
+chunk_00003.m4s
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00004.m4s", DurationS: 4.0, Codecs: "avc1.64001f", Resolution: "1280x720"}, false)
+
+	xpectedChunkStr := "#EXT-X-DISCONTINUITY\n#EXT-X-MAP:URI=\"init00000.mp4\"\n#EXTINF:4.00000000,\nchunk_00004.m4s\n"
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, xpectedChunkStr) {
+		t.Errorf("Format change is not correct, got %s, want %s", manifestStr, xpectedChunkStr)
+	}
+}
@@ -0,0 +1,89 @@
+package hls
+
+import (
+	"bytes"
+)
+
+const (
+	// KeyFormatWidevine Widevine KEYFORMAT
+	KeyFormatWidevine = "urn:uuid:edef8ba9-79d6-4ace-a3c8-27dcd51d21ed"
+
+	// KeyFormatPlayReady PlayReady KEYFORMAT
+	KeyFormatPlayReady = "com.microsoft.playready"
+
+	// KeyFormatFairPlay FairPlay KEYFORMAT
+	KeyFormatFairPlay = "com.apple.streamingkeydelivery"
+
+	// HlsVersionKeyFormat Minimum version for KEYFORMAT and KEYFORMATVERSIONS
+	HlsVersionKeyFormat = 5
+)
+
+// Key Encryption key information (#EXT-X-KEY)
+type Key struct {
+	Method            string
+	URI               string
+	IV                string
+	KeyFormat         string
+	KeyFormatVersions string
+}
+
+// String write key info (#EXT-X-KEY). Attributes are always written in this order: METHOD, URI, IV, KEYFORMAT, KEYFORMATVERSIONS
+func (k *Key) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXT-X-KEY:METHOD=" + k.Method)
+
+	if k.URI != "" {
+		buffer.WriteString(",URI=\"" + escapeQuotes(k.URI) + "\"")
+	}
+	if k.IV != "" {
+		buffer.WriteString(",IV=" + k.IV)
+	}
+	if k.KeyFormat != "" {
+		buffer.WriteString(",KEYFORMAT=\"" + escapeQuotes(k.KeyFormat) + "\"")
+	}
+	if k.KeyFormatVersions != "" {
+		buffer.WriteString(",KEYFORMATVERSIONS=\"" + escapeQuotes(k.KeyFormatVersions) + "\"")
+	}
+	buffer.WriteString("\n")
+
+	return buffer.String()
+}
+
+// SetKeys Sets the keys (one per KEYFORMAT for multi-DRM) that apply to the chunks added from now on.
+// Call it without keys to stop encrypting
+func (p *Hls) SetKeys(keys ...Key) {
+	p.currentKeys = append([]Key(nil), keys...)
+}
+
+func keysEqual(a []Key, b []Key) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// keysString Returns the key lines to write before a chunk if its keys are different from the previous ones
+func keysString(previousKeys []Key, keys []Key) string {
+	if keysEqual(previousKeys, keys) {
+		return ""
+	}
+
+	if len(keys) == 0 {
+		return "#EXT-X-KEY:METHOD=NONE\n"
+	}
+
+	var buffer bytes.Buffer
+	for _, key := range keys {
+		buffer.WriteString(key.String())
+	}
+
+	return buffer.String()
+}
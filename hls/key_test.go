@@ -0,0 +1,62 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestKeysMultiDRM(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	h.SetKeys(
+		Key{Method: "SAMPLE-AES", URI: "data:text/plain;base64,AAAA", KeyFormat: KeyFormatWidevine, KeyFormatVersions: "1"},
+		Key{Method: "SAMPLE-AES", URI: "data:text/plain;charset=UTF-16;base64,BBBB", KeyFormat: KeyFormatPlayReady, KeyFormatVersions: "1"},
+		Key{Method: "SAMPLE-AES", URI: "skd://key1", KeyFormat: KeyFormatFairPlay, KeyFormatVersions: "1"},
+	)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+	xpectedKeys := `#EXTINF:4.00000000,
+chunk_00000.ts
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="data:text/plain;base64,AAAA",KEYFORMAT="urn:uuid:edef8ba9-79d6-4ace-a3c8-27dcd51d21ed",KEYFORMATVERSIONS="1"
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="data:text/plain;charset=UTF-16;base64,BBBB",KEYFORMAT="com.microsoft.playready",KEYFORMATVERSIONS="1"
+#EXT-X-KEY:METHOD=SAMPLE-AES,URI="skd://key1",KEYFORMAT="com.apple.streamingkeydelivery",KEYFORMATVERSIONS="1"
+#EXTINF:4.00000000,
+chunk_00001.ts
+#EXTINF:4.00000000,
+chunk_00002.ts
+`
+	if !strings.Contains(manifestStr, xpectedKeys) {
+		t.Errorf("Keys are not correct, got %s, want %s", manifestStr, xpectedKeys)
+	}
+	if n := strings.Count(manifestStr, "#EXT-X-KEY"); n != 3 {
+		t.Errorf("Keys should only be written when they change, got %d key lines", n)
+	}
+}
+
+func TestKeysChangeAndStop(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	h.SetKeys(Key{Method: "AES-128", URI: "key1.bin"})
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.SetKeys(Key{Method: "AES-128", URI: "key2.bin"})
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.SetKeys()
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+	xpectedChunks := `#EXT-X-KEY:METHOD=AES-128,URI="key1.bin"
+#EXTINF:4.00000000,
+chunk_00000.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key2.bin"
+#EXTINF:4.00000000,
+chunk_00001.ts
+#EXT-X-KEY:METHOD=NONE
+#EXTINF:4.00000000,
+chunk_00002.ts
+`
+	if !strings.Contains(manifestStr, xpectedChunks) {
+		t.Errorf("Keys are not correct, got %s, want %s", manifestStr, xpectedChunks)
+	}
+}
@@ -0,0 +1,175 @@
+package hls
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	// AlignmentToleranceS Max difference between chunk boundaries of related chunklists
+	AlignmentToleranceS = 0.1
+)
+
+// IssueSeverities indicates how serious a lint issue is
+type IssueSeverities int
+
+const (
+	// IssueWarning Allowed by the spec but probably a mistake
+	IssueWarning IssueSeverities = iota
+
+	// IssueError Not compliant with the spec
+	IssueError
+)
+
+// Issue Problem found linting a chunklist
+type Issue struct {
+	Severity IssueSeverities
+	Message  string
+
+	// ChunkIndex Index of the chunk with the problem, -1 if it applies to the whole chunklist
+	ChunkIndex int
+}
+
+// Lint Checks the chunklist against RFC 8216 and returns all the problems found (dry run, nothing is published)
+func (p *Hls) Lint() []Issue {
+	issues := make([]Issue, 0)
+
+	if version := p.EffectiveVersion(); version < p.requiredVersion() {
+		issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("version %d is lower than required %d", version, p.requiredVersion()), ChunkIndex: -1})
+	}
+
+	fileNames := make(map[string]int)
+	for i, chunk := range p.chunks {
+		if chunk.DurationS < 0 {
+			issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("chunk %d (%s) has negative duration %f", i, chunk.FileName, chunk.DurationS), ChunkIndex: i})
+		}
+		if p.targetDurS > 0 && chunk.DurationS > p.targetDurS {
+			issues = append(issues, Issue{Severity: IssueWarning, Message: fmt.Sprintf("chunk %d (%s) duration %f exceeds target duration %f", i, chunk.FileName, chunk.DurationS, p.targetDurS), ChunkIndex: i})
+		}
+
+		initFileName := p.chunkInitFileName(chunk)
+		if p.v3Compat && (initFileName != "" || isFragmentedMP4(chunk.FileName)) {
+			issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("chunk %d (%s) is fMP4 or has an init chunk, not supported by HLS v3", i, chunk.FileName), ChunkIndex: i})
+		}
+		if initFileName == "" && isFragmentedMP4(chunk.FileName) {
+			issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("chunk %d (%s) is fMP4 but there is no init chunk", i, chunk.FileName), ChunkIndex: i})
+		} else if initFileName != "" && isFragmentedMP4(initFileName) != isFragmentedMP4(chunk.FileName) {
+			issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("init chunk %s format does not match chunk %d (%s)", initFileName, i, chunk.FileName), ChunkIndex: i})
+		}
+
+		if i > 0 && !chunk.ProgramDateTime.IsZero() && !p.chunks[i-1].ProgramDateTime.IsZero() && !chunk.IsDisco {
+			if chunk.ProgramDateTime.Before(p.chunks[i-1].ProgramDateTime) {
+				issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("chunk %d (%s) program date time is not monotonic", i, chunk.FileName), ChunkIndex: i})
+			}
+		}
+
+		if p.rejectQuotes {
+			for _, fileName := range append([]string{initFileName}, partFileNames(chunk.Parts)...) {
+				if strings.Contains(p.chunkURI(fileName), "\"") {
+					issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("chunk %d (%s) quoted URI %s contains a double quote", i, chunk.FileName, fileName), ChunkIndex: i})
+				}
+			}
+		}
+
+		if p.parentURIMode == ParentURIReject {
+			for _, fileName := range append([]string{chunk.FileName, initFileName}, partFileNames(chunk.Parts)...) {
+				if uri := p.chunkURI(fileName); fileName != "" && isParentURI(uri) {
+					issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("chunk %d (%s) URI %s is above the chunklist directory", i, chunk.FileName, uri), ChunkIndex: i})
+				}
+			}
+		}
+
+		// In VOD all the chunks are kept, a duplicate is a packaging error
+		if first, found := fileNames[chunk.FileName]; found && chunk.InlineData == nil {
+			severity := IssueWarning
+			if p.manifestType == Vod {
+				severity = IssueError
+			}
+			issues = append(issues, Issue{Severity: severity, Message: fmt.Sprintf("chunk %d (%s) has the same filename as chunk %d", i, chunk.FileName, first), ChunkIndex: i})
+		} else {
+			fileNames[chunk.FileName] = i
+		}
+	}
+
+	if p.rejectQuotes {
+		for _, fileName := range partFileNames(p.parts) {
+			if strings.Contains(p.chunkURI(fileName), "\"") {
+				issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("part quoted URI %s contains a double quote", fileName), ChunkIndex: -1})
+			}
+		}
+	}
+
+	issues = append(issues, p.mapLayoutIssues()...)
+
+	if p.maxLineLength > 0 {
+		for i, line := range strings.Split(p.String(), "\n") {
+			if len(line) > p.maxLineLength {
+				issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("line %d length %d exceeds maximum %d", i+1, len(line), p.maxLineLength), ChunkIndex: -1})
+			}
+		}
+	}
+
+	return issues
+}
+
+// mapLayoutIssues Checks that the #EXT-X-MAP of each fMP4 chunk only changes after a discontinuity
+// (a chunk without init chunk is reported by Lint)
+func (p *Hls) mapLayoutIssues() []Issue {
+	issues := make([]Issue, 0)
+
+	for i, chunk := range p.chunks {
+		if i == 0 || chunk.IsDisco || !isFragmentedMP4(chunk.FileName) {
+			continue
+		}
+
+		if mapStr := p.chunkMapString(chunk); mapStr != "" && mapStr != p.chunkMapString(p.chunks[i-1]) {
+			issues = append(issues, Issue{Severity: IssueError, Message: fmt.Sprintf("#EXT-X-MAP before chunk %d changes the init chunk without a discontinuity", i), ChunkIndex: i})
+		}
+	}
+
+	return issues
+}
+
+func partFileNames(parts []Part) []string {
+	ret := make([]string, 0, len(parts))
+	for _, part := range parts {
+		ret = append(ret, part.FileName)
+	}
+
+	return ret
+}
+
+// CheckAlignment Checks that the chunk boundaries of related media chunklists (ex: video, audio,
+// subtitles) with the same media sequences are aligned within AlignmentToleranceS, and returns a
+// warning for each misaligned chunk (misalignment can cause A/V desync)
+func (p *Hls) CheckAlignment(others ...*Hls) []Issue {
+	issues := make([]Issue, 0)
+
+	mseq := p.mediaSequence()
+	for _, other := range others {
+		otherMseq := other.mediaSequence()
+		first := mseq
+		if otherMseq > first {
+			first = otherMseq
+		}
+		last := mseq + int64(len(p.chunks))
+		if otherLast := otherMseq + int64(len(other.chunks)); otherLast < last {
+			last = otherLast
+		}
+
+		var endS durationAccumulator
+		var otherEndS durationAccumulator
+		for seq := first; seq < last; seq++ {
+			i := int(seq - mseq)
+			endS.Add(p.chunks[i].DurationS)
+			otherEndS.Add(other.chunks[seq-otherMseq].DurationS)
+
+			if diffS := math.Abs(endS.Sum() - otherEndS.Sum()); diffS > AlignmentToleranceS {
+				issues = append(issues, Issue{Severity: IssueWarning, Message: fmt.Sprintf("chunk %d (%s) end is %.3fs apart from %s", i, p.chunks[i].FileName, diffS, other.chunklistFileName), ChunkIndex: i})
+			}
+		}
+	}
+
+	return issues
+}
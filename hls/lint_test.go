@@ -0,0 +1,146 @@
+package hls
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHlsLintSeveralProblems(t *testing.T) {
+	pdt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 5)
+	h.SetInitChunk("results/init00000.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, ProgramDateTime: pdt}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 6.0, ProgramDateTime: pdt.Add(-time.Second)}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.m4s", DurationS: 4.0}, false)
+
+	xpectedIssues := []Issue{
+		{Severity: IssueError, ChunkIndex: -1},
+		{Severity: IssueWarning, ChunkIndex: 1},
+		{Severity: IssueError, ChunkIndex: 1},
+		{Severity: IssueWarning, ChunkIndex: 2},
+		{Severity: IssueError, ChunkIndex: 3},
+	}
+
+	issues := h.Lint()
+	if len(issues) != len(xpectedIssues) {
+		t.Fatalf("Number of issues is not correct, got %d (%v), want %d", len(issues), issues, len(xpectedIssues))
+	}
+	for i, xpectedIssue := range xpectedIssues {
+		if issues[i].Severity != xpectedIssue.Severity || issues[i].ChunkIndex != xpectedIssue.ChunkIndex {
+			t.Errorf("Issue %d is not correct, got %v, want severity %d and chunk %d", i, issues[i], xpectedIssue.Severity, xpectedIssue.ChunkIndex)
+		}
+	}
+}
+
+func TestHlsLintNoProblems(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	if issues := h.Lint(); len(issues) != 0 {
+		t.Errorf("Unexpected issues, got %v", issues)
+	}
+}
+
+func TestHlsCheckAlignment(t *testing.T) {
+	video := New(logrus.New(), LiveWindow, 3, false, 4.0, 5, "results/video.m3u8", "", HlsOutputModeNone, nil, "", "")
+	audio := New(logrus.New(), LiveWindow, 3, false, 4.0, 5, "results/audio.m3u8", "", HlsOutputModeNone, nil, "", "")
+	subtitles := New(logrus.New(), LiveWindow, 3, false, 4.0, 5, "results/subtitles.m3u8", "", HlsOutputModeNone, nil, "", "")
+
+	videoDurations := []float64{4.0, 4.0, 4.0, 4.0}
+	audioDurations := []float64{4.02, 3.99, 4.0, 3.98}
+	subtitlesDurations := []float64{4.0, 4.5, 4.0, 3.5}
+	for i := range videoDurations {
+		video.AddChunk(Chunk{FileName: fmt.Sprintf("results/video_%05d.ts", i), DurationS: videoDurations[i]}, false)
+		audio.AddChunk(Chunk{FileName: fmt.Sprintf("results/audio_%05d.ts", i), DurationS: audioDurations[i]}, false)
+		subtitles.AddChunk(Chunk{FileName: fmt.Sprintf("results/subtitles_%05d.vtt", i), DurationS: subtitlesDurations[i]}, false)
+	}
+
+	if issues := video.CheckAlignment(&audio); len(issues) != 0 {
+		t.Errorf("Unexpected issues for aligned chunklists, got %v", issues)
+	}
+
+	// Chunks 1 and 2 end 0.5s later, chunk 3 is aligned again
+	issues := video.CheckAlignment(&audio, &subtitles)
+	xpectedChunkIndexes := []int{1, 2}
+	if len(issues) != len(xpectedChunkIndexes) {
+		t.Fatalf("Number of issues is not correct, got %d (%v), want %d", len(issues), issues, len(xpectedChunkIndexes))
+	}
+	for i, xpectedChunkIndex := range xpectedChunkIndexes {
+		if issues[i].ChunkIndex != xpectedChunkIndex || issues[i].Severity != IssueWarning || !strings.Contains(issues[i].Message, "results/subtitles.m3u8") {
+			t.Errorf("Issue %d is not correct, got %v, want a warning for chunk %d", i, issues[i], xpectedChunkIndex)
+		}
+	}
+}
+
+func TestHlsCheckAlignmentMediaSequenceFromFileName(t *testing.T) {
+	video := New(logrus.New(), LiveWindow, 3, false, 4.0, 5, "results/video.m3u8", "", HlsOutputModeNone, nil, "", "")
+	audio := New(logrus.New(), LiveWindow, 3, false, 4.0, 5, "results/audio.m3u8", "", HlsOutputModeNone, nil, "", "")
+
+	// Video renders media sequence 1 from its filenames, audio counts it from 0 and has a longer 1st chunk
+	video.SetMediaSequenceFromFileName(regexp.MustCompile(`^video_(\d+)\.ts$`))
+	audio.AddChunk(Chunk{FileName: "results/audio_00000.ts", DurationS: 6.0}, false)
+	for i := 1; i <= 4; i++ {
+		video.AddChunk(Chunk{FileName: fmt.Sprintf("results/video_%05d.ts", i), DurationS: 4.0}, false)
+		audio.AddChunk(Chunk{FileName: fmt.Sprintf("results/audio_%05d.ts", i), DurationS: 4.0}, false)
+	}
+
+	if issues := video.CheckAlignment(&audio); len(issues) != 0 {
+		t.Errorf("Unexpected issues for aligned chunklists, got %v", issues)
+	}
+}
+
+func TestHlsLintMapLayout(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.SetHlsVersion(7)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0, InitFileName: "results/init_0.mp4"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 4.0, InitFileName: "results/init_0.mp4"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.m4s", DurationS: 4.0, InitFileName: "results/init_1.mp4", IsDisco: true}, false)
+
+	if issues := h.Lint(); len(issues) != 0 {
+		t.Errorf("Unexpected issues, got %v", issues)
+	}
+}
+
+func TestHlsLintMapAfterChunk(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.SetHlsVersion(7)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0, InitFileName: "results/init_0.mp4"}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 4.0, InitFileName: "results/init_1.mp4"}, false)
+
+	xpectedIssue := Issue{Severity: IssueError, Message: "#EXT-X-MAP before chunk 1 changes the init chunk without a discontinuity", ChunkIndex: 1}
+	if issues := h.Lint(); len(issues) != 1 || issues[0] != xpectedIssue {
+		t.Errorf("Issues are not correct, got %v, want [%v]", issues, xpectedIssue)
+	}
+}
+
+func TestHlsLintChunkBeforeMap(t *testing.T) {
+	// TS chunks do not need a MAP
+	h := newTestHls(LiveWindow, 5)
+	h.SetHlsVersion(7)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 4.0, InitFileName: "results/init_0.mp4", IsDisco: true}, false)
+
+	if issues := h.Lint(); len(issues) != 0 {
+		t.Errorf("Unexpected issues, got %v", issues)
+	}
+
+	// A MAP introduced without a discontinuity after TS chunks
+	h = newTestHls(LiveWindow, 5)
+	h.SetHlsVersion(7)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.m4s", DurationS: 4.0, InitFileName: "results/init_0.mp4"}, false)
+
+	xpectedIssue := Issue{Severity: IssueError, Message: "#EXT-X-MAP before chunk 2 changes the init chunk without a discontinuity", ChunkIndex: 2}
+	if issues := h.Lint(); len(issues) != 1 || issues[0] != xpectedIssue {
+		t.Errorf("Issues are not correct, got %v, want [%v]", issues, xpectedIssue)
+	}
+}
@@ -0,0 +1,310 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+)
+
+const (
+	// ClosedCaptionsNone Indicates that a variant has no closed captions (rendered unquoted)
+	ClosedCaptionsNone = "NONE"
+)
+
+// RenditionTypes indicates the rendition media type
+type RenditionTypes int
+
+const (
+	// RenditionAudio Audio rendition
+	RenditionAudio RenditionTypes = iota
+
+	// RenditionVideo Video rendition
+	RenditionVideo
+
+	// RenditionSubtitles Subtitles rendition
+	RenditionSubtitles
+
+	// RenditionClosedCaptions Closed captions rendition
+	RenditionClosedCaptions
+)
+
+var renditionTypeNames = map[RenditionTypes]string{
+	RenditionAudio:          "AUDIO",
+	RenditionVideo:          "VIDEO",
+	RenditionSubtitles:      "SUBTITLES",
+	RenditionClosedCaptions: "CLOSED-CAPTIONS",
+}
+
+// Rendition Alternative rendition information (#EXT-X-MEDIA)
+type Rendition struct {
+	Type       RenditionTypes
+	GroupID    string
+	Name       string
+	Language   string
+	Default    bool
+	Autoselect bool
+	Forced     bool
+	InstreamID string
+	URI        string
+
+	// StableRenditionID Identifier that stays the same across playlist updates (STABLE-RENDITION-ID)
+	StableRenditionID string
+
+	// BitDepth Audio bit depth (ex: 24 for hi-res audio), 0 is not written
+	BitDepth int
+
+	// SampleRate Audio sample rate in Hz, 0 is not written
+	SampleRate int
+
+	// AssocLanguage Associated language (ex: a regional dialect of Language), written as ASSOC-LANGUAGE
+	AssocLanguage string
+}
+
+// Variant Variant stream information (#EXT-X-STREAM-INF)
+type Variant struct {
+	URI              string
+	Bandwidth        int64
+	AverageBandwidth int64
+	Codecs           string
+	Resolution       string
+	FrameRate        float64
+	Audio            string
+	Subtitles        string
+	ClosedCaptions   string
+
+	// StableVariantID Identifier that stays the same across playlist updates (STABLE-VARIANT-ID)
+	StableVariantID string
+
+	// PathwayID Content steering pathway (CDN) of the variant
+	PathwayID string
+}
+
+// Start Preferred point to start playing (#EXT-X-START)
+type Start struct {
+	TimeOffsetS float64
+	Precise     bool
+}
+
+// String write start info (#EXT-X-START)
+func (s *Start) String() string {
+	ret := "#EXT-X-START:TIME-OFFSET=" + fmt.Sprintf("%.3f", s.TimeOffsetS)
+	if s.Precise {
+		ret = ret + ",PRECISE=YES"
+	}
+
+	return ret + "\n"
+}
+
+// ContentSteering Content steering server information (#EXT-X-CONTENT-STEERING)
+type ContentSteering struct {
+	ServerURI string
+
+	// PathwayID Pathway used until the steering manifest is loaded (optional)
+	PathwayID string
+}
+
+// String write content steering info (#EXT-X-CONTENT-STEERING)
+func (c *ContentSteering) String() string {
+	ret := "#EXT-X-CONTENT-STEERING:SERVER-URI=\"" + escapeQuotes(c.ServerURI) + "\""
+	if c.PathwayID != "" {
+		ret = ret + ",PATHWAY-ID=\"" + escapeQuotes(c.PathwayID) + "\""
+	}
+
+	return ret + "\n"
+}
+
+// Master Hls master playlist
+type Master struct {
+	version         int
+	start           *Start
+	contentSteering *ContentSteering
+	renditions      []Rendition
+	variants        []Variant
+}
+
+// NewMaster Creates a hls master playlist
+func NewMaster(version int) Master {
+	m := Master{
+		version:    version,
+		renditions: make([]Rendition, 0),
+		variants:   make([]Variant, 0),
+	}
+
+	return m
+}
+
+// SetStart Sets the preferred start point for all the variants
+func (m *Master) SetStart(start Start) {
+	m.start = &start
+}
+
+// SetContentSteering Sets the content steering server
+func (m *Master) SetContentSteering(contentSteering ContentSteering) {
+	m.contentSteering = &contentSteering
+}
+
+// AddRendition Adds a new alternative rendition
+func (m *Master) AddRendition(rendition Rendition) {
+	m.renditions = append(m.renditions, rendition)
+}
+
+// AddVariant Adds a new variant stream
+func (m *Master) AddVariant(variant Variant) {
+	m.variants = append(m.variants, variant)
+}
+
+// String write rendition info (#EXT-X-MEDIA). Attributes are always written in this order: TYPE, GROUP-ID, NAME,
+// LANGUAGE, ASSOC-LANGUAGE, DEFAULT, AUTOSELECT, FORCED, INSTREAM-ID, BIT-DEPTH, SAMPLE-RATE, STABLE-RENDITION-ID, URI
+func (r *Rendition) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXT-X-MEDIA:TYPE=" + renditionTypeNames[r.Type])
+	buffer.WriteString(",GROUP-ID=\"" + escapeQuotes(r.GroupID) + "\"")
+	buffer.WriteString(",NAME=\"" + escapeQuotes(r.Name) + "\"")
+
+	if r.Language != "" {
+		buffer.WriteString(",LANGUAGE=\"" + escapeQuotes(r.Language) + "\"")
+	}
+	if r.AssocLanguage != "" {
+		buffer.WriteString(",ASSOC-LANGUAGE=\"" + escapeQuotes(r.AssocLanguage) + "\"")
+	}
+	if r.Default {
+		buffer.WriteString(",DEFAULT=YES")
+	}
+	if r.Autoselect {
+		buffer.WriteString(",AUTOSELECT=YES")
+	}
+	if r.Forced {
+		buffer.WriteString(",FORCED=YES")
+	}
+	if r.InstreamID != "" {
+		buffer.WriteString(",INSTREAM-ID=\"" + escapeQuotes(r.InstreamID) + "\"")
+	}
+	if r.BitDepth > 0 {
+		buffer.WriteString(",BIT-DEPTH=" + strconv.Itoa(r.BitDepth))
+	}
+	if r.SampleRate > 0 {
+		buffer.WriteString(",SAMPLE-RATE=" + strconv.Itoa(r.SampleRate))
+	}
+	if r.StableRenditionID != "" {
+		buffer.WriteString(",STABLE-RENDITION-ID=\"" + escapeQuotes(r.StableRenditionID) + "\"")
+	}
+	if r.URI != "" {
+		buffer.WriteString(",URI=\"" + escapeQuotes(r.URI) + "\"")
+	}
+	buffer.WriteString("\n")
+
+	return buffer.String()
+}
+
+// String write variant info (#EXT-X-STREAM-INF and URI). Attributes are always written in this order: BANDWIDTH,
+// AVERAGE-BANDWIDTH, CODECS, RESOLUTION, FRAME-RATE, AUDIO, SUBTITLES, CLOSED-CAPTIONS, STABLE-VARIANT-ID, PATHWAY-ID
+func (v *Variant) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXT-X-STREAM-INF:BANDWIDTH=" + strconv.FormatInt(v.Bandwidth, 10))
+
+	if v.AverageBandwidth > 0 {
+		buffer.WriteString(",AVERAGE-BANDWIDTH=" + strconv.FormatInt(v.AverageBandwidth, 10))
+	}
+	if v.Codecs != "" {
+		buffer.WriteString(",CODECS=\"" + escapeQuotes(v.Codecs) + "\"")
+	}
+	if v.Resolution != "" {
+		buffer.WriteString(",RESOLUTION=" + v.Resolution)
+	}
+	if v.FrameRate > 0 {
+		buffer.WriteString(",FRAME-RATE=" + fmt.Sprintf("%.3f", v.FrameRate))
+	}
+	if v.Audio != "" {
+		buffer.WriteString(",AUDIO=\"" + escapeQuotes(v.Audio) + "\"")
+	}
+	if v.Subtitles != "" {
+		buffer.WriteString(",SUBTITLES=\"" + escapeQuotes(v.Subtitles) + "\"")
+	}
+	if v.ClosedCaptions == ClosedCaptionsNone {
+		buffer.WriteString(",CLOSED-CAPTIONS=" + ClosedCaptionsNone)
+	} else if v.ClosedCaptions != "" {
+		buffer.WriteString(",CLOSED-CAPTIONS=\"" + escapeQuotes(v.ClosedCaptions) + "\"")
+	}
+	if v.StableVariantID != "" {
+		buffer.WriteString(",STABLE-VARIANT-ID=\"" + escapeQuotes(v.StableVariantID) + "\"")
+	}
+	if v.PathwayID != "" {
+		buffer.WriteString(",PATHWAY-ID=\"" + escapeQuotes(v.PathwayID) + "\"")
+	}
+	buffer.WriteString("\n")
+
+	buffer.WriteString(v.URI + "\n")
+
+	return buffer.String()
+}
+
+// hasGroup Returns true if there is a rendition of type renditionType in the group groupID
+func (m *Master) hasGroup(renditionType RenditionTypes, groupID string) bool {
+	for _, rendition := range m.renditions {
+		if rendition.Type == renditionType && rendition.GroupID == groupID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Validate Checks that every AUDIO, SUBTITLES and CLOSED-CAPTIONS group of the variants has
+// renditions, and returns all the dangling references as a *ValidationError
+func (m *Master) Validate() error {
+	errs := make([]error, 0)
+
+	for _, variant := range m.variants {
+		references := []struct {
+			renditionType RenditionTypes
+			groupID       string
+		}{
+			{RenditionAudio, variant.Audio},
+			{RenditionSubtitles, variant.Subtitles},
+			{RenditionClosedCaptions, variant.ClosedCaptions},
+		}
+
+		for _, reference := range references {
+			if reference.groupID == "" || (reference.renditionType == RenditionClosedCaptions && reference.groupID == ClosedCaptionsNone) {
+				continue
+			}
+			if !m.hasGroup(reference.renditionType, reference.groupID) {
+				errs = append(errs, fmt.Errorf("variant %s references %s group %q without #EXT-X-MEDIA", variant.URI, renditionTypeNames[reference.renditionType], reference.groupID))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// String write info to master playlist
+func (m *Master) String() string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXTM3U\n")
+	buffer.WriteString("#EXT-X-VERSION:" + strconv.Itoa(m.version) + "\n")
+
+	if m.start != nil {
+		buffer.WriteString(m.start.String())
+	}
+
+	if m.contentSteering != nil {
+		buffer.WriteString(m.contentSteering.String())
+	}
+
+	for _, rendition := range m.renditions {
+		buffer.WriteString(rendition.String())
+	}
+
+	for _, variant := range m.variants {
+		buffer.WriteString(variant.String())
+	}
+
+	return buffer.String()
+}
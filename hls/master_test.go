@@ -0,0 +1,187 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMasterVariants(t *testing.T) {
+	m := NewMaster(3)
+	m.AddVariant(Variant{URI: "480p.m3u8", Bandwidth: 996000, Resolution: "854x480", Codecs: "avc1.4d401f,mp4a.40.2"})
+	m.AddVariant(Variant{URI: "360p.m3u8", Bandwidth: 548000, Resolution: "640x360", ClosedCaptions: "cc"})
+
+	manifestStr := m.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=996000,CODECS="avc1.4d401f,mp4a.40.2",RESOLUTION=854x480
+480p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=548000,RESOLUTION=640x360,CLOSED-CAPTIONS="cc"
+360p.m3u8
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Master data is different, got %s , expected %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestMasterClosedCaptionsNone(t *testing.T) {
+	m := NewMaster(3)
+	m.AddVariant(Variant{URI: "480p.m3u8", Bandwidth: 996000, ClosedCaptions: ClosedCaptionsNone})
+
+	manifestStr := m.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-STREAM-INF:BANDWIDTH=996000,CLOSED-CAPTIONS=NONE
+480p.m3u8
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Master data is different, got %s , expected %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestMasterForcedSubtitlesRendition(t *testing.T) {
+	m := NewMaster(3)
+	m.AddRendition(Rendition{Type: RenditionSubtitles, GroupID: "subs", Name: "English", Language: "en", Default: true, Autoselect: true, URI: "subs_en.m3u8"})
+	m.AddRendition(Rendition{Type: RenditionSubtitles, GroupID: "subs", Name: "English (forced)", Language: "en", Forced: true, URI: "subs_en_forced.m3u8"})
+	m.AddVariant(Variant{URI: "480p.m3u8", Bandwidth: 996000, Subtitles: "subs"})
+
+	manifestStr := m.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES,URI="subs_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English (forced)",LANGUAGE="en",FORCED=YES,URI="subs_en_forced.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=996000,SUBTITLES="subs"
+480p.m3u8
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Master data is different, got %s , expected %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestMasterStart(t *testing.T) {
+	m := NewMaster(3)
+	m.SetStart(Start{TimeOffsetS: -12.5, Precise: true})
+	m.AddVariant(Variant{URI: "480p.m3u8", Bandwidth: 996000})
+
+	manifestStr := m.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-START:TIME-OFFSET=-12.500,PRECISE=YES
+#EXT-X-STREAM-INF:BANDWIDTH=996000
+480p.m3u8
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Master data is different, got %s , expected %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestMasterStableIDs(t *testing.T) {
+	m := NewMaster(3)
+	m.AddRendition(Rendition{Type: RenditionAudio, GroupID: "aac", Name: "English", StableRenditionID: "audio-en", URI: "audio_en.m3u8"})
+	m.AddRendition(Rendition{Type: RenditionAudio, GroupID: "aac", Name: "French", URI: "audio_fr.m3u8"})
+	m.AddVariant(Variant{URI: "480p.m3u8", Bandwidth: 996000, Audio: "aac", StableVariantID: "480p"})
+	m.AddVariant(Variant{URI: "360p.m3u8", Bandwidth: 548000, Audio: "aac"})
+
+	manifestStr := m.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",STABLE-RENDITION-ID="audio-en",URI="audio_en.m3u8"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="French",URI="audio_fr.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=996000,AUDIO="aac",STABLE-VARIANT-ID="480p"
+480p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=548000,AUDIO="aac"
+360p.m3u8
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Master data is different, got %s , expected %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestMasterHiResAudioRendition(t *testing.T) {
+	m := NewMaster(3)
+	m.AddRendition(Rendition{Type: RenditionAudio, GroupID: "alac", Name: "Lossless", BitDepth: 24, SampleRate: 96000, URI: "audio_alac.m3u8"})
+
+	xpectedRendition := "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"alac\",NAME=\"Lossless\",BIT-DEPTH=24,SAMPLE-RATE=96000,URI=\"audio_alac.m3u8\"\n"
+	if manifestStr := m.String(); !strings.Contains(manifestStr, xpectedRendition) {
+		t.Errorf("Rendition is not correct, got %s, want %s", manifestStr, xpectedRendition)
+	}
+}
+
+func TestMasterAssocLanguageRendition(t *testing.T) {
+	m := NewMaster(3)
+	m.AddRendition(Rendition{Type: RenditionAudio, GroupID: "aac", Name: "Portuguese (Brazil)", Language: "pt", AssocLanguage: "pt-BR", URI: "audio_pt_br.m3u8"})
+
+	xpectedRendition := "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"Portuguese (Brazil)\",LANGUAGE=\"pt\",ASSOC-LANGUAGE=\"pt-BR\",URI=\"audio_pt_br.m3u8\"\n"
+	if manifestStr := m.String(); !strings.Contains(manifestStr, xpectedRendition) {
+		t.Errorf("Rendition is not correct, got %s, want %s", manifestStr, xpectedRendition)
+	}
+}
+
+func TestMasterContentSteering(t *testing.T) {
+	m := NewMaster(3)
+	m.SetContentSteering(ContentSteering{ServerURI: "https://steering.example.com/manifest.json", PathwayID: "CDN-A"})
+	m.AddVariant(Variant{URI: "https://a.example.com/480p.m3u8", Bandwidth: 996000, PathwayID: "CDN-A"})
+	m.AddVariant(Variant{URI: "https://b.example.com/480p.m3u8", Bandwidth: 996000, PathwayID: "CDN-B"})
+
+	manifestStr := m.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-CONTENT-STEERING:SERVER-URI="https://steering.example.com/manifest.json",PATHWAY-ID="CDN-A"
+#EXT-X-STREAM-INF:BANDWIDTH=996000,PATHWAY-ID="CDN-A"
+https://a.example.com/480p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=996000,PATHWAY-ID="CDN-B"
+https://b.example.com/480p.m3u8
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Master data is different, got %s , expected %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestMasterValidateGroups(t *testing.T) {
+	m := NewMaster(3)
+	m.AddRendition(Rendition{Type: RenditionAudio, GroupID: "aac", Name: "English", URI: "audio_en.m3u8"})
+	m.AddRendition(Rendition{Type: RenditionSubtitles, GroupID: "subs", Name: "English", URI: "subs_en.m3u8"})
+	m.AddRendition(Rendition{Type: RenditionClosedCaptions, GroupID: "cc", Name: "English", InstreamID: "CC1"})
+	m.AddVariant(Variant{URI: "480p.m3u8", Bandwidth: 996000, Audio: "aac", Subtitles: "subs", ClosedCaptions: "cc"})
+	m.AddVariant(Variant{URI: "360p.m3u8", Bandwidth: 548000, Audio: "aac", ClosedCaptions: ClosedCaptionsNone})
+
+	if err := m.Validate(); err != nil {
+		t.Errorf("Unexpected error for valid groups, got %v", err)
+	}
+
+	// Audio group with the SUBTITLES name is not valid
+	m.AddVariant(Variant{URI: "240p.m3u8", Bandwidth: 248000, Audio: "ac3", Subtitles: "aac"})
+
+	err := m.Validate()
+	if err == nil {
+		t.Fatalf("Expected a dangling group error")
+	}
+	for _, xpectedMsg := range []string{"variant 240p.m3u8 references AUDIO group \"ac3\"", "variant 240p.m3u8 references SUBTITLES group \"aac\""} {
+		if !strings.Contains(err.Error(), xpectedMsg) {
+			t.Errorf("Error %q not found in %s", xpectedMsg, err.Error())
+		}
+	}
+}
+
+func TestMasterGolden(t *testing.T) {
+	newGoldenMaster := func() Master {
+		m := NewMaster(7)
+		m.AddRendition(Rendition{Type: RenditionAudio, GroupID: "aac", Name: "English", Language: "en", AssocLanguage: "en-US", Default: true, Autoselect: true, BitDepth: 16, SampleRate: 48000, StableRenditionID: "audio-en", URI: "audio_en.m3u8"})
+		m.AddRendition(Rendition{Type: RenditionSubtitles, GroupID: "subs", Name: "English", Language: "en", Forced: true, URI: "subs_en.m3u8"})
+		m.AddVariant(Variant{URI: "720p.m3u8", Bandwidth: 2996000, AverageBandwidth: 2500000, Codecs: "avc1.64001f,mp4a.40.2", Resolution: "1280x720", FrameRate: 29.97, Audio: "aac", Subtitles: "subs", ClosedCaptions: ClosedCaptionsNone, StableVariantID: "720p", PathwayID: "CDN-A"})
+		return m
+	}
+
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:7
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="aac",NAME="English",LANGUAGE="en",ASSOC-LANGUAGE="en-US",DEFAULT=YES,AUTOSELECT=YES,BIT-DEPTH=16,SAMPLE-RATE=48000,STABLE-RENDITION-ID="audio-en",URI="audio_en.m3u8"
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="en",FORCED=YES,URI="subs_en.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=2996000,AVERAGE-BANDWIDTH=2500000,CODECS="avc1.64001f,mp4a.40.2",RESOLUTION=1280x720,FRAME-RATE=29.970,AUDIO="aac",SUBTITLES="subs",CLOSED-CAPTIONS=NONE,STABLE-VARIANT-ID="720p",PATHWAY-ID="CDN-A"
+720p.m3u8
+`
+	for i := 0; i < 10; i++ {
+		m := newGoldenMaster()
+		if manifestStr := m.String(); manifestStr != xpectedmanifestStr {
+			t.Fatalf("Master playlist is not correct (run %d), got %s, want %s", i, manifestStr, xpectedmanifestStr)
+		}
+	}
+}
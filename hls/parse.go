@@ -0,0 +1,240 @@
+package hls
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrParseNoHeader The data does not start with #EXTM3U
+	ErrParseNoHeader = errors.New("missing #EXTM3U header")
+)
+
+// ParseOptions Options to create a Hls chunklist from a parsed one
+type ParseOptions struct {
+	Log *logrus.Logger
+
+	// ChunklistFileName Chunklist path, parsed URIs are relative to its directory
+	ChunklistFileName string
+
+	// SlidingWindowSize Window size used if the playlist is parsed as LiveWindow (no #EXT-X-PLAYLIST-TYPE),
+	// it is checked once the type is known
+	SlidingWindowSize int
+	OutputType        OutputTypes
+	HTTPClient        *http.Client
+	HTTPScheme        string
+	HTTPHost          string
+
+	// StripPrefix Prefix (ex: CDN base URL) removed from each parsed URI to recover bare filenames
+	StripPrefix string
+
+	// NormalizeBackslashes Replaces backslashes by slashes in the parsed URIs (ex: playlists generated on Windows)
+	NormalizeBackslashes bool
+
+	// CheckDiscontinuitySequence Warns about a negative discontinuity sequence (see Hls.CheckNegativeDiscontinuitySequence)
+	CheckDiscontinuitySequence bool
+
+	// RepairDiscontinuitySequence Checks the discontinuity sequence and resets it to 0 if it is negative
+	RepairDiscontinuitySequence bool
+
+	// MarkDiscontinuityOnResume Flags the 1st chunk added after parsing as discontinuity (ex: encoder restart)
+	MarkDiscontinuityOnResume bool
+}
+
+// parseAttributes Parses a tag attribute list (KEY=VALUE,KEY="VALUE",...) removing quotes
+func parseAttributes(attributeList string) map[string]string {
+	ret := make(map[string]string)
+
+	for len(attributeList) > 0 {
+		eq := strings.IndexByte(attributeList, '=')
+		if eq < 0 {
+			break
+		}
+		name := strings.TrimSpace(attributeList[:eq])
+		attributeList = attributeList[eq+1:]
+
+		value := ""
+		if strings.HasPrefix(attributeList, "\"") {
+			end := strings.IndexByte(attributeList[1:], '"')
+			if end < 0 {
+				value = attributeList[1:]
+				attributeList = ""
+			} else {
+				value = attributeList[1 : end+1]
+				attributeList = attributeList[end+2:]
+			}
+		} else {
+			end := strings.IndexByte(attributeList, ',')
+			if end < 0 {
+				end = len(attributeList)
+			}
+			value = attributeList[:end]
+			attributeList = attributeList[end:]
+		}
+		attributeList = strings.TrimPrefix(attributeList, ",")
+
+		ret[name] = value
+	}
+
+	return ret
+}
+
+// parseByteRange Parses a byte range (<length>[@<offset>], offset 0 if absent), "" is the whole file (0, 0)
+func parseByteRange(byteRange string) (int64, int64, error) {
+	if byteRange == "" {
+		return 0, 0, nil
+	}
+
+	parts := strings.SplitN(byteRange, "@", 2)
+	length, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	offset := int64(0)
+	if len(parts) == 2 {
+		offset, err = strconv.ParseInt(parts[1], 10, 64)
+	}
+
+	return length, offset, err
+}
+
+// parseURI Returns the chunk filename from a parsed URI, absolute URIs (with a scheme or from the root)
+// are kept as is
+func parseURI(uri string, options ParseOptions) string {
+	if options.NormalizeBackslashes {
+		uri = strings.Replace(uri, "\\", "/", -1)
+	}
+	if options.StripPrefix != "" {
+		uri = strings.TrimPrefix(uri, options.StripPrefix)
+	}
+
+	if hasURIScheme(uri) || strings.HasPrefix(uri, "/") {
+		return uri
+	}
+
+	return path.Join(path.Dir(options.ChunklistFileName), uri)
+}
+
+// Parse Creates a Hls chunklist from a media playlist. The type is Vod or LiveEvent from #EXT-X-PLAYLIST-TYPE,
+// LiveWindow if there is none. Media and discontinuity sequences are used as declared (a leading #EXT-X-DISCONTINUITY
+// does not change them)
+func Parse(r io.Reader, options ParseOptions) (Hls, error) {
+	// Created as Vod so the window size is only checked (see checkSlidingWindowSize) if the playlist is a LiveWindow
+	p := New(options.Log, Vod, HlsVersionFloatDuration, false, 0, options.SlidingWindowSize, options.ChunklistFileName, "", options.OutputType, options.HTTPClient, options.HTTPScheme, options.HTTPHost)
+	p.manifestType = LiveWindow
+
+	scanner := bufio.NewScanner(r)
+	lineNum := 0
+	chunk := Chunk{}
+	// bitrateKbps #EXT-X-BITRATE applies to the following chunks until the next one
+	bitrateKbps := int64(0)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		lineNum++
+
+		if lineNum == 1 {
+			if line != "#EXTM3U" {
+				return p, ErrParseNoHeader
+			}
+			continue
+		}
+		if line == "" {
+			continue
+		}
+
+		err := error(nil)
+		tag, value := line, ""
+		if i := strings.IndexByte(line, ':'); i >= 0 && strings.HasPrefix(line, "#") {
+			tag, value = line[:i], line[i+1:]
+		}
+
+		switch tag {
+		case "#EXT-X-VERSION":
+			p.version, err = strconv.Atoi(value)
+		case "#EXT-X-TARGETDURATION":
+			p.targetDurS, err = strconv.ParseFloat(value, 64)
+		case "#EXT-X-MEDIA-SEQUENCE":
+			p.mseq, err = strconv.ParseInt(value, 10, 64)
+		case "#EXT-X-DISCONTINUITY-SEQUENCE":
+			p.dseq, err = strconv.ParseInt(value, 10, 64)
+		case "#EXT-X-PLAYLIST-TYPE":
+			if value == "VOD" {
+				p.manifestType = Vod
+			} else if value == "EVENT" {
+				p.manifestType = LiveEvent
+			}
+		case "#EXT-X-INDEPENDENT-SEGMENTS":
+			p.isIndependentSegments = true
+		case "#EXT-X-ENDLIST":
+			p.isClosed = true
+		case "#EXT-X-MAP":
+			attributes := parseAttributes(value)
+			p.initChunkDataFileName = parseURI(attributes["URI"], options)
+			p.initByteRangeLength, p.initByteRangeOffset, err = parseByteRange(attributes["BYTERANGE"])
+		case "#EXT-X-KEY":
+			attributes := parseAttributes(value)
+			if attributes["METHOD"] == "NONE" {
+				p.currentKeys = nil
+			} else {
+				key := Key{Method: attributes["METHOD"], URI: attributes["URI"], IV: attributes["IV"], KeyFormat: attributes["KEYFORMAT"], KeyFormatVersions: attributes["KEYFORMATVERSIONS"]}
+				if len(chunk.Keys) == 0 {
+					p.currentKeys = nil
+				}
+				p.currentKeys = append(p.currentKeys, key)
+				chunk.Keys = p.currentKeys
+			}
+		case "#EXT-X-DISCONTINUITY":
+			chunk.IsDisco = true
+		case "#EXT-X-PROGRAM-DATE-TIME":
+			chunk.ProgramDateTime, err = time.Parse(time.RFC3339Nano, value)
+		case "#EXT-X-BITRATE":
+			bitrateKbps, err = strconv.ParseInt(value, 10, 64)
+		case "#EXTINF":
+			chunk.DurationS, err = strconv.ParseFloat(strings.SplitN(value, ",", 2)[0], 64)
+		default:
+			if !strings.HasPrefix(line, "#") {
+				chunk.FileName = parseURI(line, options)
+				chunk.InitFileName = p.initChunkDataFileName
+				chunk.InitByteRangeLength = p.initByteRangeLength
+				chunk.InitByteRangeOffset = p.initByteRangeOffset
+				chunk.BitrateKbps = bitrateKbps
+				if chunk.Keys == nil {
+					chunk.Keys = p.currentKeys
+				}
+				p.chunks = append(p.chunks, chunk)
+				chunk = Chunk{}
+			}
+			// Unknown tags and comments are skipped
+		}
+
+		if err != nil {
+			return p, fmt.Errorf("line %d: %v", lineNum, err)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return p, err
+	}
+	if lineNum == 0 {
+		return p, ErrParseNoHeader
+	}
+
+	p.checkSlidingWindowSize()
+	if options.CheckDiscontinuitySequence || options.RepairDiscontinuitySequence {
+		p.CheckNegativeDiscontinuitySequence(options.RepairDiscontinuitySequence)
+	}
+	p.discoOnNextChunk = options.MarkDiscontinuityOnResume && len(p.chunks) > 0
+
+	return p, nil
+}
@@ -0,0 +1,289 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	manifestStr := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-DISCONTINUITY-SEQUENCE:1
+#EXT-X-TARGETDURATION:4
+#EXT-X-INDEPENDENT-SEGMENTS
+#EXT-X-MAP:URI="init00000.ts"
+#EXT-X-KEY:METHOD=AES-128,URI="key1.bin",IV=0x0123456789abcdef0123456789abcdef
+#EXT-X-BITRATE:2500
+#EXTINF:4.00000000,
+chunk_00010.ts
+#EXT-X-DISCONTINUITY
+#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:00.000Z
+#EXTINF:3.50000000,
+chunk_00011.ts
+#EXT-X-ENDLIST
+`
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+
+	if h.String() != manifestStr {
+		t.Errorf("Round trip is not correct, got %s, want %s", h.String(), manifestStr)
+	}
+
+	xpectedFileName := "results/chunk_00010.ts"
+	if h.chunks[0].FileName != xpectedFileName {
+		t.Errorf("Filename is not correct, got %s, want %s", h.chunks[0].FileName, xpectedFileName)
+	}
+
+	// The bitrate applies until the next #EXT-X-BITRATE
+	xpectedBitrateKbps := int64(2500)
+	for i, chunk := range h.chunks {
+		if chunk.BitrateKbps != xpectedBitrateKbps {
+			t.Errorf("Bitrate of chunk %d is not correct, got %d, want %d", i, chunk.BitrateKbps, xpectedBitrateKbps)
+		}
+	}
+}
+
+func TestParseMapByteRange(t *testing.T) {
+	manifestStr := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="stream.mp4",BYTERANGE="720@0"
+#EXTINF:4.00000000,
+chunk_00000.m4s
+#EXT-X-MAP:URI="stream.mp4",BYTERANGE="720@5000"
+#EXTINF:4.00000000,
+chunk_00001.m4s
+#EXT-X-ENDLIST
+`
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+
+	if h.String() != manifestStr {
+		t.Errorf("Round trip is not correct, got %s, want %s", h.String(), manifestStr)
+	}
+
+	xpectedOffsets := []int64{0, 5000}
+	for i, xpectedOffset := range xpectedOffsets {
+		if h.chunks[i].InitByteRangeLength != 720 || h.chunks[i].InitByteRangeOffset != xpectedOffset {
+			t.Errorf("Init byte range of chunk %d is not correct, got %d@%d, want %d@%d", i, h.chunks[i].InitByteRangeLength, h.chunks[i].InitByteRangeOffset, 720, xpectedOffset)
+		}
+	}
+
+	if _, err := Parse(strings.NewReader("#EXTM3U\n#EXT-X-MAP:URI=\"stream.mp4\",BYTERANGE=\"abc\"\n"), ParseOptions{ChunklistFileName: "results/chunklist.m3u8"}); err == nil {
+		t.Errorf("Invalid byte range should return an error")
+	}
+}
+
+func TestParseStripPrefix(t *testing.T) {
+	manifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.00000000,
+https://cdn.example.com/live/chunk_00000.ts
+#EXTINF:4.00000000,
+https://cdn.example.com/live/chunk_00001.ts
+#EXTINF:4.00000000,
+other/chunk_00002.ts
+`
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", StripPrefix: "https://cdn.example.com/live/"})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+
+	xpectedFileNames := []string{"results/chunk_00000.ts", "results/chunk_00001.ts", "results/other/chunk_00002.ts"}
+	if len(h.chunks) != len(xpectedFileNames) {
+		t.Fatalf("Number of chunks is not correct, got %d, want %d", len(h.chunks), len(xpectedFileNames))
+	}
+	for i, xpectedFileName := range xpectedFileNames {
+		if h.chunks[i].FileName != xpectedFileName {
+			t.Errorf("Filename is not correct, got %s, want %s", h.chunks[i].FileName, xpectedFileName)
+		}
+	}
+}
+
+func TestParseAbsoluteURIs(t *testing.T) {
+	manifestStr := `#EXTM3U
+#EXT-X-VERSION:6
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-TARGETDURATION:4
+#EXT-X-MAP:URI="https://cdn.example.com/live/init.mp4"
+#EXTINF:4.00000000,
+https://cdn.example.com/live/chunk_00000.m4s
+#EXTINF:4.00000000,
+/live/chunk_00001.m4s
+#EXTINF:4.00000000,
+chunk_00002.m4s
+`
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+
+	xpectedInitFileName := "https://cdn.example.com/live/init.mp4"
+	if h.initChunkDataFileName != xpectedInitFileName {
+		t.Errorf("Init filename is not correct, got %s, want %s", h.initChunkDataFileName, xpectedInitFileName)
+	}
+	xpectedFileNames := []string{"https://cdn.example.com/live/chunk_00000.m4s", "/live/chunk_00001.m4s", "results/chunk_00002.m4s"}
+	for i, xpectedFileName := range xpectedFileNames {
+		if h.chunks[i].FileName != xpectedFileName {
+			t.Errorf("Filename is not correct, got %s, want %s", h.chunks[i].FileName, xpectedFileName)
+		}
+	}
+
+	if h.String() != manifestStr {
+		t.Errorf("Round trip is not correct, got %s, want %s", h.String(), manifestStr)
+	}
+}
+
+func TestParseNoHeader(t *testing.T) {
+	if _, err := Parse(strings.NewReader("#EXTINF:4.0,\nchunk.ts\n"), ParseOptions{}); err != ErrParseNoHeader {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrParseNoHeader)
+	}
+}
+
+func TestParseLeadingDiscontinuity(t *testing.T) {
+	manifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:7
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXT-X-TARGETDURATION:4
+#EXT-X-DISCONTINUITY
+#EXTINF:4.00000000,
+chunk_00007.ts
+#EXTINF:4.00000000,
+chunk_00008.ts
+#EXT-X-DISCONTINUITY
+#EXTINF:4.00000000,
+chunk_00009.ts
+`
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+
+	if h.String() != manifestStr {
+		t.Errorf("Round trip is not correct, got %s, want %s", h.String(), manifestStr)
+	}
+
+	// Evicting the leading discontinuity continues from the declared sequence
+	h.AddChunk(Chunk{FileName: "results/chunk_00010.ts", DurationS: 4.0}, false)
+	if h.dseq != 4 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, 4)
+	}
+	if h.mseq != 8 {
+		t.Errorf("Media sequence is not correct, got %d, want %d", h.mseq, 8)
+	}
+
+	// Evicting a chunk without discontinuity keeps it
+	h.AddChunk(Chunk{FileName: "results/chunk_00011.ts", DurationS: 4.0}, false)
+	if h.dseq != 4 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, 4)
+	}
+}
+
+func TestParseNormalizeBackslashes(t *testing.T) {
+	manifestStr := "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:4\n#EXT-X-MAP:URI=\"init\\init00000.mp4\"\n#EXTINF:4.00000000,\nsegments\\chunk_00000.m4s\n"
+
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", NormalizeBackslashes: true})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+
+	xpectedFileName := "results/segments/chunk_00000.m4s"
+	if h.chunks[0].FileName != xpectedFileName {
+		t.Errorf("Filename is not correct, got %s, want %s", h.chunks[0].FileName, xpectedFileName)
+	}
+	xpectedInitFileName := "results/init/init00000.mp4"
+	if h.chunks[0].InitFileName != xpectedInitFileName {
+		t.Errorf("Init filename is not correct, got %s, want %s", h.chunks[0].InitFileName, xpectedInitFileName)
+	}
+}
+
+func TestParseRepairDiscontinuitySequence(t *testing.T) {
+	// Restarted packager: the discontinuity sequence is above the media sequence, it is valid
+	manifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:3
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.00000000,
+chunk_00000.ts
+`
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3, RepairDiscontinuitySequence: true})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+	if h.dseq != 3 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, 3)
+	}
+	if !h.CheckNegativeDiscontinuitySequence(false) {
+		t.Errorf("Discontinuity sequence above the media sequence should be consistent")
+	}
+
+	manifestStr = strings.Replace(manifestStr, "#EXT-X-DISCONTINUITY-SEQUENCE:3", "#EXT-X-DISCONTINUITY-SEQUENCE:-1", 1)
+	h, err = Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+	if h.CheckNegativeDiscontinuitySequence(false) {
+		t.Errorf("Negative discontinuity sequence should be inconsistent")
+	}
+	if h.dseq != -1 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, -1)
+	}
+
+	h, err = Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3, RepairDiscontinuitySequence: true})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+	if h.dseq != 0 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, 0)
+	}
+}
+
+func TestParseMarkDiscontinuityOnResume(t *testing.T) {
+	manifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:10
+#EXT-X-DISCONTINUITY-SEQUENCE:2
+#EXT-X-TARGETDURATION:4
+#EXTINF:4.00000000,
+chunk_00010.ts
+#EXTINF:4.00000000,
+chunk_00011.ts
+`
+	h, err := Parse(strings.NewReader(manifestStr), ParseOptions{ChunklistFileName: "results/chunklist.m3u8", SlidingWindowSize: 3, MarkDiscontinuityOnResume: true})
+	if err != nil {
+		t.Fatalf("Unexpected error parsing, got %v", err)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00012.ts", DurationS: 4.0}, false)
+
+	xpectedChunksStr := "chunk_00011.ts\n#EXT-X-DISCONTINUITY\n#EXTINF:4.00000000,\nchunk_00012.ts\n"
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, xpectedChunksStr) {
+		t.Errorf("Resume discontinuity is not correct, got %s, want %s", manifestStr, xpectedChunksStr)
+	}
+
+	// Only the 1st chunk is flagged, evicting it increments the discontinuity sequence
+	for i := 13; i < 16; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, false)
+	}
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-DISCONTINUITY\n") {
+		t.Errorf("Only the 1st chunk after resume should be a discontinuity, got %s", manifestStr)
+	}
+	if h.dseq != 3 {
+		t.Errorf("Discontinuity sequence is not correct, got %d, want %d", h.dseq, 3)
+	}
+	if h.mseq != 13 {
+		t.Errorf("Media sequence is not correct, got %d, want %d", h.mseq, 13)
+	}
+}
@@ -0,0 +1,281 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// PartHoldBackFactor PART-HOLD-BACK in part target durations (spec minimum)
+	PartHoldBackFactor = 3
+
+	// PartRetentionTargetDurations Parts less than this number of target durations from the end must be kept (spec)
+	PartRetentionTargetDurations = 3
+
+	// MinPartDurationS Duration of the parts with a non positive duration when they are clamped
+	MinPartDurationS = 0.001
+)
+
+var (
+	// ErrPartInvalidDuration Part with zero or negative duration
+	ErrPartInvalidDuration = errors.New("part duration must be positive")
+
+	// ErrPartTargetNotSet Part added without a part target duration (#EXT-X-PART requires #EXT-X-PART-INF)
+	ErrPartTargetNotSet = errors.New("part target duration not set")
+)
+
+// PreloadHintTypes indicates the type of resource of a preload hint
+type PreloadHintTypes int
+
+const (
+	// PreloadHintPart Hint of the next part
+	PreloadHintPart PreloadHintTypes = iota
+
+	// PreloadHintMap Hint of the next init chunk
+	PreloadHintMap
+)
+
+var preloadHintTypeNames = map[PreloadHintTypes]string{
+	PreloadHintPart: "PART",
+	PreloadHintMap:  "MAP",
+}
+
+// PreloadHint LL-HLS resource that clients can request before it is available (#EXT-X-PRELOAD-HINT)
+type PreloadHint struct {
+	Type     PreloadHintTypes
+	FileName string
+
+	// ByteRangeStart Offset of the resource inside FileName
+	ByteRangeStart int64
+
+	// ByteRangeLength Length of the resource inside FileName, 0 means until the end of the file
+	ByteRangeLength int64
+}
+
+// Part LL-HLS partial segment information (#EXT-X-PART)
+type Part struct {
+	FileName    string
+	DurationS   float64
+	Independent bool
+
+	// Gap The part is not available (ex: lost during ingest)
+	Gap bool
+
+	// ByteRangeLength Length of the part inside FileName (ex: CMAF chunk of a growing segment), 0 means whole file
+	ByteRangeLength int64
+
+	// ByteRangeOffset Offset of the part inside FileName. If 0 and the previous part is
+	// a byte range of the same file, it is inferred as the end of the previous one
+	ByteRangeOffset int64
+}
+
+// SetPartTargetDuration Sets the LL-HLS part target duration (#EXT-X-PART-INF), 0 disables it
+func (p *Hls) SetPartTargetDuration(partTargetDurS float64) {
+	p.partTargetDurS = partTargetDurS
+}
+
+// SetLowLatency Writes the LL-HLS tags (#EXT-X-PART-INF, PART-HOLD-BACK) even if there are no parts.
+// By default they are only written when the chunklist has parts, to not confuse non LL clients
+func (p *Hls) SetLowLatency(lowLatency bool) {
+	p.lowLatency = lowLatency
+}
+
+// isLowLatency Returns true if LL-HLS is enabled or there are parts or a preload hint in the chunklist
+func (p *Hls) isLowLatency() bool {
+	if p.lowLatency || len(p.parts) > 0 || p.preloadHint != nil {
+		return true
+	}
+
+	for _, chunk := range p.chunks {
+		if len(chunk.Parts) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SetPartRetentionSegments Sets for how many of the last completed chunks the parts are kept (0 means all)
+func (p *Hls) SetPartRetentionSegments(partRetentionSegments int) {
+	p.partRetentionSegments = partRetentionSegments
+}
+
+// pruneParts Removes the parts of the completed chunks older than the retention, then caps the number of parts
+func (p *Hls) pruneParts() {
+	defer p.capParts()
+
+	if p.partRetentionSegments <= 0 {
+		return
+	}
+
+	for i := 0; i < len(p.chunks)-p.partRetentionSegments; i++ {
+		p.chunks[i].Parts = nil
+	}
+}
+
+// SetClampPartDurations Adds the parts with a zero or negative duration with MinPartDurationS and a warning,
+// instead of refusing them with ErrPartInvalidDuration
+func (p *Hls) SetClampPartDurations(clampPartDurations bool) {
+	p.clampPartDurations = clampPartDurations
+}
+
+// SetMaxParts Caps the total number of #EXT-X-PART lines (0 means no cap), the oldest parts are removed first.
+// A warning is logged if the cap removes parts that the spec requires to keep
+func (p *Hls) SetMaxParts(maxParts int) {
+	p.maxParts = maxParts
+	p.capParts()
+}
+
+// partRetainedChunkIndex Returns the index of the 1st chunk whose parts are less than
+// PartRetentionTargetDurations target durations from the end of the chunklist
+func (p *Hls) partRetainedChunkIndex() int {
+	var endS durationAccumulator
+	for _, part := range p.parts {
+		endS.Add(part.DurationS)
+	}
+
+	for i := len(p.chunks) - 1; i >= 0; i-- {
+		if endS.Sum() >= float64(PartRetentionTargetDurations*p.targetDuration()) {
+			return i + 1
+		}
+		endS.Add(p.chunks[i].DurationS)
+	}
+
+	return 0
+}
+
+// capParts Removes the oldest parts of the completed chunks above the max number of parts
+func (p *Hls) capParts() {
+	if p.maxParts <= 0 {
+		return
+	}
+
+	excess := len(p.parts) - p.maxParts
+	for _, chunk := range p.chunks {
+		excess += len(chunk.Parts)
+	}
+	if excess <= 0 {
+		return
+	}
+
+	retainedIndex := p.partRetainedChunkIndex()
+	droppedRetained := 0
+	for i := 0; i < len(p.chunks) && excess > 0; i++ {
+		dropped := len(p.chunks[i].Parts)
+		if dropped > excess {
+			dropped = excess
+		}
+		if dropped == 0 {
+			continue
+		}
+
+		if i >= retainedIndex {
+			droppedRetained += dropped
+		}
+		p.chunks[i].Parts = p.chunks[i].Parts[dropped:]
+		if len(p.chunks[i].Parts) == 0 {
+			p.chunks[i].Parts = nil
+		}
+		excess -= dropped
+	}
+
+	if droppedRetained > 0 {
+		p.log.Warn("Max parts ", p.maxParts, " removed ", droppedRetained, " parts less than ", PartRetentionTargetDurations, " target durations from the end of ", p.chunklistFileName)
+	}
+	if excess > 0 {
+		p.log.Warn("Max parts ", p.maxParts, " is lower than the ", len(p.parts), " parts of the chunk being generated in ", p.chunklistFileName)
+	}
+}
+
+// SetPreloadHint Sets the preload hint written at the end of the chunklist (it is not written once closed)
+func (p *Hls) SetPreloadHint(preloadHint PreloadHint) {
+	p.preloadHint = &preloadHint
+}
+
+// ClearPreloadHint Removes the preload hint
+func (p *Hls) ClearPreloadHint() {
+	p.preloadHint = nil
+}
+
+// AddPart Adds a part to the chunk being generated, the parts are attached to the next added chunk.
+// Parts with a zero or negative duration are refused with ErrPartInvalidDuration (see SetClampPartDurations),
+// a filename with a double quote with ErrQuotedAttribute if they are rejected (see SetRejectQuotes), and all the parts
+// with ErrPartTargetNotSet until SetPartTargetDuration is called
+func (p *Hls) AddPart(part Part, saveChunklist bool) error {
+	ret := error(nil)
+
+	if p.rejectQuotes && strings.Contains(p.chunkURI(part.FileName), "\"") {
+		return ErrQuotedAttribute
+	}
+
+	if p.partTargetDurS <= 0 {
+		return ErrPartTargetNotSet
+	}
+
+	if part.DurationS <= 0 {
+		if !p.clampPartDurations {
+			return ErrPartInvalidDuration
+		}
+		p.log.Warn("Part ", part.FileName, " has invalid duration ", part.DurationS, ", using ", MinPartDurationS)
+		part.DurationS = MinPartDurationS
+	}
+
+	if part.ByteRangeLength > 0 && part.ByteRangeOffset == 0 && len(p.parts) > 0 {
+		previous := p.parts[len(p.parts)-1]
+		if previous.FileName == part.FileName && previous.ByteRangeLength > 0 {
+			part.ByteRangeOffset = previous.ByteRangeOffset + previous.ByteRangeLength
+		}
+	}
+
+	p.parts = append(p.parts, part)
+	p.capParts()
+
+	if saveChunklist {
+		ret = p.saveChunklist(p.partTransferMode)
+	}
+
+	return ret
+}
+
+// partString Returns the #EXT-X-PART line of a part
+func (p *Hls) partString(part Part) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXT-X-PART:DURATION=" + fmt.Sprintf("%.5f", part.DurationS))
+	buffer.WriteString(",URI=\"" + p.quotedURI(part.FileName) + "\"")
+
+	if part.ByteRangeLength > 0 {
+		buffer.WriteString(",BYTERANGE=\"" + strconv.FormatInt(part.ByteRangeLength, 10) + "@" + strconv.FormatInt(part.ByteRangeOffset, 10) + "\"")
+	}
+
+	if part.Independent {
+		buffer.WriteString(",INDEPENDENT=YES")
+	}
+	if part.Gap {
+		buffer.WriteString(",GAP=YES")
+	}
+	buffer.WriteString("\n")
+
+	return buffer.String()
+}
+
+// preloadHintString Returns the #EXT-X-PRELOAD-HINT line of a preload hint
+func (p *Hls) preloadHintString(preloadHint PreloadHint) string {
+	var buffer bytes.Buffer
+
+	buffer.WriteString("#EXT-X-PRELOAD-HINT:TYPE=" + preloadHintTypeNames[preloadHint.Type])
+	buffer.WriteString(",URI=\"" + p.quotedURI(preloadHint.FileName) + "\"")
+
+	if preloadHint.ByteRangeStart > 0 {
+		buffer.WriteString(",BYTERANGE-START=" + strconv.FormatInt(preloadHint.ByteRangeStart, 10))
+	}
+	if preloadHint.ByteRangeLength > 0 {
+		buffer.WriteString(",BYTERANGE-LENGTH=" + strconv.FormatInt(preloadHint.ByteRangeLength, 10))
+	}
+	buffer.WriteString("\n")
+
+	return buffer.String()
+}
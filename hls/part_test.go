@@ -0,0 +1,276 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	logrustest "github.com/sirupsen/logrus/hooks/test"
+)
+
+func TestHlsPartsGap(t *testing.T) {
+	h := newTestHls(LiveEvent, 3)
+	h.SetPartTargetDuration(1.0)
+
+	h.AddPart(Part{FileName: "results/chunk_00000.0.ts", DurationS: 1.0, Independent: true}, false)
+	h.AddPart(Part{FileName: "results/chunk_00000.1.ts", DurationS: 1.0, Gap: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 2.0}, false)
+	h.AddPart(Part{FileName: "results/chunk_00001.0.ts", DurationS: 1.0, Independent: true, Gap: true}, false)
+	h.AddPart(Part{FileName: "results/chunk_00001.1.ts", DurationS: 1.0}, false)
+
+	manifestStr := h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.000
+#EXT-X-PART-INF:PART-TARGET=1.000
+#EXT-X-PART:DURATION=1.00000,URI="chunk_00000.0.ts",INDEPENDENT=YES
+#EXT-X-PART:DURATION=1.00000,URI="chunk_00000.1.ts",GAP=YES
+#EXTINF:2.00000000,
+chunk_00000.ts
+#EXT-X-PART:DURATION=1.00000,URI="chunk_00001.0.ts",INDEPENDENT=YES,GAP=YES
+#EXT-X-PART:DURATION=1.00000,URI="chunk_00001.1.ts"
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestHlsPartsCMAFByteRanges(t *testing.T) {
+	h := newTestHls(LiveEvent, 3)
+	h.SetInitChunk("results/init.mp4")
+	h.SetPartTargetDuration(1.0)
+
+	h.AddPart(Part{FileName: "results/chunk_00000.m4s", DurationS: 1.0, Independent: true, ByteRangeLength: 1000}, false)
+	h.AddPart(Part{FileName: "results/chunk_00000.m4s", DurationS: 1.0, ByteRangeLength: 1200}, false)
+	h.AddPart(Part{FileName: "results/chunk_00000.m4s", DurationS: 1.0, ByteRangeLength: 900}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 3.0}, false)
+
+	manifestStr := h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.000
+#EXT-X-PART-INF:PART-TARGET=1.000
+#EXT-X-MAP:URI="init.mp4"
+#EXT-X-PART:DURATION=1.00000,URI="chunk_00000.m4s",BYTERANGE="1000@0",INDEPENDENT=YES
+#EXT-X-PART:DURATION=1.00000,URI="chunk_00000.m4s",BYTERANGE="1200@1000"
+#EXT-X-PART:DURATION=1.00000,URI="chunk_00000.m4s",BYTERANGE="900@2200"
+#EXTINF:3.00000000,
+chunk_00000.m4s
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestHlsPartRetentionSegments(t *testing.T) {
+	h := newTestHls(LiveEvent, 10)
+	h.SetPartTargetDuration(1.0)
+	h.SetPartRetentionSegments(2)
+
+	for i := 0; i < 4; i++ {
+		h.AddPart(Part{FileName: fmt.Sprintf("results/chunk_%05d.0.ts", i), DurationS: 2.0, Independent: true}, false)
+		h.AddPart(Part{FileName: fmt.Sprintf("results/chunk_%05d.1.ts", i), DurationS: 2.0}, false)
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, false)
+	}
+	h.AddPart(Part{FileName: "results/chunk_00004.0.ts", DurationS: 2.0, Independent: true}, false)
+
+	xpectedPartsCount := []int{0, 0, 2, 2}
+	for i, xpectedParts := range xpectedPartsCount {
+		if len(h.chunks[i].Parts) != xpectedParts {
+			t.Errorf("Number of parts of chunk %d is not correct, got %d, want %d", i, len(h.chunks[i].Parts), xpectedParts)
+		}
+	}
+
+	// 2 completed chunks with 2 parts + 1 in progress part
+	xpectedPartLines := 5
+	if partLines := strings.Count(h.String(), "#EXT-X-PART:"); partLines != xpectedPartLines {
+		t.Errorf("Number of #EXT-X-PART is not correct, got %d, want %d", partLines, xpectedPartLines)
+	}
+}
+
+func TestHlsPreloadHintMapByteRange(t *testing.T) {
+	h := newTestHls(LiveEvent, 3)
+	h.SetPartTargetDuration(1.0)
+
+	h.SetPreloadHint(PreloadHint{Type: PreloadHintMap, FileName: "results/stream.mp4", ByteRangeLength: 800})
+	xpectedHint := "#EXT-X-PRELOAD-HINT:TYPE=MAP,URI=\"stream.mp4\",BYTERANGE-LENGTH=800\n"
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, xpectedHint) {
+		t.Errorf("Preload hint is not correct, got %s, want %s", manifestStr, xpectedHint)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 2.0, InitFileName: "results/stream.mp4", InitByteRangeLength: 800}, false)
+	h.SetPreloadHint(PreloadHint{Type: PreloadHintMap, FileName: "results/stream.mp4", ByteRangeStart: 20000, ByteRangeLength: 750})
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 2.0, InitFileName: "results/stream.mp4", InitByteRangeLength: 750, InitByteRangeOffset: 20000}, false)
+	h.SetPreloadHint(PreloadHint{Type: PreloadHintPart, FileName: "results/chunk_00002.0.m4s"})
+
+	manifestStr := h.String()
+	xpectedmanifestStr := `#EXTM3U
+#EXT-X-VERSION:3
+#EXT-X-MEDIA-SEQUENCE:0
+#EXT-X-DISCONTINUITY-SEQUENCE:0
+#EXT-X-PLAYLIST-TYPE:EVENT
+#EXT-X-TARGETDURATION:4
+#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.000
+#EXT-X-PART-INF:PART-TARGET=1.000
+#EXT-X-MAP:URI="stream.mp4",BYTERANGE="800@0"
+#EXTINF:2.00000000,
+chunk_00000.m4s
+#EXT-X-MAP:URI="stream.mp4",BYTERANGE="750@20000"
+#EXTINF:2.00000000,
+chunk_00001.m4s
+#EXT-X-PRELOAD-HINT:TYPE=PART,URI="chunk_00002.0.m4s"
+`
+	if manifestStr != xpectedmanifestStr {
+		t.Errorf("Chunklist is not correct, got %s, want %s", manifestStr, xpectedmanifestStr)
+	}
+}
+
+func TestHlsPartInfOnlyWithParts(t *testing.T) {
+	h := newTestHls(LiveEvent, 3)
+	h.SetPartTargetDuration(1.0)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+	if strings.Contains(manifestStr, "#EXT-X-PART-INF") || strings.Contains(manifestStr, "#EXT-X-SERVER-CONTROL") {
+		t.Errorf("LL-HLS tags should not be written without parts, got %s", manifestStr)
+	}
+
+	h.SetLowLatency(true)
+	manifestStr = h.String()
+	for _, xpectedTag := range []string{"#EXT-X-SERVER-CONTROL:PART-HOLD-BACK=3.000\n", "#EXT-X-PART-INF:PART-TARGET=1.000\n"} {
+		if !strings.Contains(manifestStr, xpectedTag) {
+			t.Errorf("Tag %s not found with low latency enabled, got %s", xpectedTag, manifestStr)
+		}
+	}
+
+	h.SetLowLatency(false)
+	h.AddPart(Part{FileName: "results/chunk_00001.0.ts", DurationS: 1.0}, false)
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-PART-INF:PART-TARGET=1.000\n") {
+		t.Errorf("#EXT-X-PART-INF should be written with parts, got %s", manifestStr)
+	}
+}
+
+func TestHlsPartsTargetDurationFromSegments(t *testing.T) {
+	h := New(logrus.New(), LiveEvent, 3, false, 0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	h.SetPartTargetDuration(0.5)
+
+	for i := 0; i < 2; i++ {
+		for j := 0; j < 4; j++ {
+			h.AddPart(Part{FileName: fmt.Sprintf("results/chunk_%05d.%d.m4s", i, j), DurationS: 0.48, Independent: j == 0}, false)
+		}
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.m4s", i), DurationS: 1.92}, false)
+	}
+	// Pending parts of the next segment
+	h.AddPart(Part{FileName: "results/chunk_00002.0.m4s", DurationS: 0.48, Independent: true}, false)
+
+	xpectedTargetDuration := "#EXT-X-TARGETDURATION:2\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedTargetDuration) {
+		t.Errorf("Target duration is not correct, got %s, want %s", manifestStr, xpectedTargetDuration)
+	}
+	if targetDuration := h.targetDuration(); targetDuration != 2 {
+		t.Errorf("Target duration is not correct, got %d, want %d", targetDuration, 2)
+	}
+}
+
+func TestHlsPartsMaxParts(t *testing.T) {
+	log, hook := logrustest.NewNullLogger()
+	h := New(log, LiveEvent, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	h.SetPartTargetDuration(1.0)
+	// The last 3 target durations (12s) must keep their parts, including the ones of the chunk being generated
+	h.SetMaxParts(16)
+
+	addChunks := func(from int, to int) {
+		for i := from; i < to; i++ {
+			for j := 0; j < 4; j++ {
+				h.AddPart(Part{FileName: fmt.Sprintf("results/chunk_%05d.%d.ts", i, j), DurationS: 1.0, Independent: j == 0}, false)
+			}
+			h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, false)
+		}
+	}
+
+	addChunks(0, 6)
+	manifestStr := h.String()
+	if count := strings.Count(manifestStr, "#EXT-X-PART:"); count != 16 {
+		t.Errorf("Number of parts is not correct, got %d, want %d", count, 16)
+	}
+	if strings.Contains(manifestStr, "chunk_00001.3.ts") || !strings.Contains(manifestStr, "chunk_00002.0.ts") {
+		t.Errorf("The oldest parts should be removed first, got %s", manifestStr)
+	}
+	if len(hook.AllEntries()) != 0 {
+		t.Errorf("Unexpected warning for a cap compatible with the retention, got %d entries", len(hook.AllEntries()))
+	}
+
+	// A lower cap removes parts that must be kept
+	h.SetMaxParts(6)
+	manifestStr = h.String()
+	if count := strings.Count(manifestStr, "#EXT-X-PART:"); count != 6 {
+		t.Errorf("Number of parts is not correct, got %d, want %d", count, 6)
+	}
+	if !strings.Contains(manifestStr, "#EXT-X-PART:DURATION=1.00000,URI=\"chunk_00004.2.ts\"\n#EXT-X-PART:DURATION=1.00000,URI=\"chunk_00004.3.ts\"\n#EXTINF") {
+		t.Errorf("The oldest parts should be removed first, got %s", manifestStr)
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Level != logrus.WarnLevel {
+		t.Errorf("Expected a warning when the cap conflicts with the retention")
+	}
+}
+
+func TestHlsPartsInvalidDuration(t *testing.T) {
+	log, hook := logrustest.NewNullLogger()
+	h := New(log, LiveEvent, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeNone, nil, "", "")
+	h.SetPartTargetDuration(1.0)
+
+	for _, durationS := range []float64{0, -0.5} {
+		if err := h.AddPart(Part{FileName: "results/chunk_00000.0.ts", DurationS: durationS}, false); err != ErrPartInvalidDuration {
+			t.Errorf("Error for duration %f is not correct, got %v, want %v", durationS, err, ErrPartInvalidDuration)
+		}
+	}
+	if len(h.parts) != 0 {
+		t.Errorf("Number of parts is not correct, got %d, want %d", len(h.parts), 0)
+	}
+
+	if err := h.AddPart(Part{FileName: "results/chunk_00000.0.ts", DurationS: 1.0}, false); err != nil {
+		t.Errorf("Unexpected error adding a valid part, got %v", err)
+	}
+
+	h.SetClampPartDurations(true)
+	if err := h.AddPart(Part{FileName: "results/chunk_00000.1.ts", DurationS: 0}, false); err != nil {
+		t.Errorf("Unexpected error clamping a part, got %v", err)
+	}
+	if len(h.parts) != 2 || h.parts[1].DurationS != MinPartDurationS {
+		t.Errorf("Clamped part is not correct, got %v, want duration %f", h.parts, MinPartDurationS)
+	}
+	if entry := hook.LastEntry(); entry == nil || entry.Level != logrus.WarnLevel {
+		t.Errorf("Expected a warning clamping a part")
+	}
+}
+
+func TestHlsPartsTargetNotSet(t *testing.T) {
+	h := newTestHls(LiveEvent, 3)
+
+	if err := h.AddPart(Part{FileName: "results/chunk_00000.0.ts", DurationS: 1.0}, false); err != ErrPartTargetNotSet {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrPartTargetNotSet)
+	}
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, Parts: []Part{{FileName: "results/chunk_00000.0.ts", DurationS: 1.0}}}, false); err != ErrPartTargetNotSet {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrPartTargetNotSet)
+	}
+	if manifestStr := h.String(); strings.Contains(manifestStr, "#EXT-X-PART:") {
+		t.Errorf("Parts should not be rendered without a part target, got %s", manifestStr)
+	}
+
+	h.SetPartTargetDuration(1.0)
+	if err := h.AddPart(Part{FileName: "results/chunk_00000.0.ts", DurationS: 1.0}, false); err != nil {
+		t.Errorf("Unexpected error adding a part, got %v", err)
+	}
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-PART-INF:PART-TARGET=") {
+		t.Errorf("Part target should be rendered with the parts, got %s", manifestStr)
+	}
+}
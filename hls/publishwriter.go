@@ -0,0 +1,51 @@
+package hls
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+var (
+	// ErrPublishWriterClosed Write or Close on a publish writer already closed
+	ErrPublishWriterClosed = errors.New("publish writer is closed")
+)
+
+// publishWriter Buffers a chunklist and publishes it to the configured output on Close
+type publishWriter struct {
+	hls    *Hls
+	buffer bytes.Buffer
+	closed bool
+}
+
+// NewPublishWriter Returns a writer for 1 publish: the bytes written are sent to the configured
+// output (file, HTTP, WebDAV) when it is closed. It allows to pipe the chunklist through custom
+// transforms (ex: p.WriteToContext(ctx, transform(w))). In strict mode the chunklist is validated first
+func (p *Hls) NewPublishWriter() (io.WriteCloser, error) {
+	if p.strictMode {
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &publishWriter{hls: p}, nil
+}
+
+// Write Adds data to the publish
+func (w *publishWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		return 0, ErrPublishWriterClosed
+	}
+
+	return w.buffer.Write(data)
+}
+
+// Close Publishes all the data written
+func (w *publishWriter) Close() error {
+	if w.closed {
+		return ErrPublishWriterClosed
+	}
+	w.closed = true
+
+	return w.hls.publish(w.buffer.Bytes(), w.hls.chunkTransferMode)
+}
@@ -0,0 +1,52 @@
+package hls
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHlsPublishWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, chunklistFileName, "", HlsOutputModeFile, nil, "", "")
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0}, false)
+
+	w, err := h.NewPublishWriter()
+	if err != nil {
+		t.Fatalf("Unexpected error creating the writer, got %v", err)
+	}
+	if _, err := h.WriteToContext(context.Background(), w); err != nil {
+		t.Fatalf("Unexpected error writing, got %v", err)
+	}
+
+	// Nothing is published until Close
+	if _, err := os.Stat(chunklistFileName); !os.IsNotExist(err) {
+		t.Errorf("Chunklist should not be saved before Close, got %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Unexpected error closing the writer, got %v", err)
+	}
+	if manifestStr := readFileString(t, chunklistFileName); manifestStr != h.String() {
+		t.Errorf("Saved chunklist is not correct, got %s, want %s", manifestStr, h.String())
+	}
+	if h.LastPublishTime().IsZero() {
+		t.Errorf("Last publish time should be set after Close")
+	}
+
+	if _, err := w.Write([]byte("#EXTM3U\n")); err != ErrPublishWriterClosed {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrPublishWriterClosed)
+	}
+}
@@ -0,0 +1,104 @@
+package hls
+
+import (
+	"net/url"
+	"sync"
+)
+
+// SetURIRewriter Sets a function applied to every chunk URI (media, init, parts) when rendering,
+// after base URL and query are added
+func (p *Hls) SetURIRewriter(uriRewriter func(uri string) string) {
+	p.uriRewriter = uriRewriter
+}
+
+// FailoverHosts Round robin host selector for chunk URIs, skipping the hosts marked as down.
+// It is safe for concurrent use
+type FailoverHosts struct {
+	mutex   sync.Mutex
+	hosts   []string
+	down    map[string]bool
+	current int
+}
+
+// NewFailoverHosts Creates a host selector, the first host is the current one
+func NewFailoverHosts(hosts ...string) *FailoverHosts {
+	f := FailoverHosts{
+		hosts: append([]string(nil), hosts...),
+		down:  make(map[string]bool),
+	}
+
+	return &f
+}
+
+// SetHostDown Marks a host as down (skipped by Next) or up
+func (f *FailoverHosts) SetHostDown(host string, down bool) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.down[host] = down
+}
+
+// Next Moves to the next host that is up and returns it (call it once per serve).
+// If all hosts are down the next one is used anyway
+func (f *FailoverHosts) Next() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.hosts) == 0 {
+		return ""
+	}
+
+	for i := 1; i <= len(f.hosts); i++ {
+		candidate := (f.current + i) % len(f.hosts)
+		if !f.down[f.hosts[candidate]] {
+			f.current = candidate
+			return f.hosts[f.current]
+		}
+	}
+	f.current = (f.current + 1) % len(f.hosts)
+
+	return f.hosts[f.current]
+}
+
+// Host Returns the current host
+func (f *FailoverHosts) Host() string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if len(f.hosts) == 0 {
+		return ""
+	}
+
+	return f.hosts[f.current]
+}
+
+// Rewrite Replaces the host of an absolute URI with the current one (relative URIs are not changed).
+// Use it as URI rewriter
+func (f *FailoverHosts) Rewrite(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" {
+		return uri
+	}
+
+	host := f.Host()
+	if host == "" {
+		return uri
+	}
+	u.Host = host
+
+	return u.String()
+}
+
+// SchemeRewriter Returns a URI rewriter that replaces the scheme of absolute URIs (ex: wss for an HLS over
+// WebSocket gateway set as segment base URL). Relative URIs are not changed
+func SchemeRewriter(scheme string) func(uri string) string {
+	return func(uri string) string {
+		u, err := url.Parse(uri)
+		if err != nil || u.Scheme == "" {
+			return uri
+		}
+		u.Scheme = scheme
+
+		return u.String()
+	}
+}
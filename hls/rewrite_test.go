@@ -0,0 +1,74 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHlsURIRewriter(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetURIRewriter(func(uri string) string {
+		return strings.ToUpper(uri)
+	})
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "\nCHUNK_00000.TS\n") {
+		t.Errorf("Chunk URI is not rewritten, got %s", manifestStr)
+	}
+}
+
+func TestHlsFailoverHostsRotation(t *testing.T) {
+	hosts := NewFailoverHosts("cdn1.example.com", "cdn2.example.com", "cdn3.example.com")
+
+	h := newTestHls(LiveWindow, 3)
+	h.SetSegmentBaseURL("https://origin.example.com/live/")
+	h.SetURIRewriter(hosts.Rewrite)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	xpectedHosts := []string{"cdn2.example.com", "cdn3.example.com", "cdn1.example.com", "cdn2.example.com"}
+	for i, xpectedHost := range xpectedHosts {
+		hosts.Next()
+
+		xpectedChunk := "\nhttps://" + xpectedHost + "/live/chunk_00000.ts\n"
+		if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedChunk) {
+			t.Errorf("Chunk URI of render %d is not correct, got %s, want %s", i, manifestStr, xpectedChunk)
+		}
+	}
+
+	// Hosts down are skipped
+	hosts.SetHostDown("cdn3.example.com", true)
+	if host := hosts.Next(); host != "cdn1.example.com" {
+		t.Errorf("Host is not correct, got %s, want %s", host, "cdn1.example.com")
+	}
+}
+
+func TestHlsSchemeRewriter(t *testing.T) {
+	h := newTestHls(LiveEvent, 3)
+	h.SetHlsVersion(HlsVersionMap)
+	h.SetInitChunk("results/init00000.mp4")
+	h.SetSegmentBaseURL("https://gw.example.com/live")
+	h.SetURIRewriter(SchemeRewriter("wss"))
+	h.SetPartTargetDuration(1.0)
+
+	h.AddPart(Part{FileName: "results/chunk_00000.0.m4s", DurationS: 1.0, Independent: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0}, false)
+
+	manifestStr := h.String()
+	for _, xpectedURI := range []string{
+		"#EXT-X-MAP:URI=\"wss://gw.example.com/live/init00000.mp4\"\n",
+		"URI=\"wss://gw.example.com/live/chunk_00000.0.m4s\"",
+		"\nwss://gw.example.com/live/chunk_00000.m4s\n",
+	} {
+		if !strings.Contains(manifestStr, xpectedURI) {
+			t.Errorf("URI is not correct, got %s, want %s", manifestStr, xpectedURI)
+		}
+	}
+	if strings.Contains(manifestStr, "https://") {
+		t.Errorf("All URIs should use the custom scheme, got %s", manifestStr)
+	}
+
+	// Relative URIs are not changed
+	if uri := SchemeRewriter("wss")("chunk_00000.ts"); uri != "chunk_00000.ts" {
+		t.Errorf("URI is not correct, got %s, want %s", uri, "chunk_00000.ts")
+	}
+}
@@ -0,0 +1,48 @@
+package hls
+
+import (
+	"encoding/base64"
+	"path"
+	"strconv"
+)
+
+// SCTE35Modes indicates how the SCTE-35 data of a chunk is written
+type SCTE35Modes int
+
+const (
+	// SCTE35DateRange Writes a #EXT-X-DATERANGE with SCTE35-OUT starting at the chunk program date time.
+	// Chunks without program date time are written as SCTE35CueOut
+	SCTE35DateRange SCTE35Modes = iota
+
+	// SCTE35CueOut Writes #EXT-OATCLS-SCTE35 (base64) and #EXT-X-CUE-OUT
+	SCTE35CueOut
+)
+
+// SetSCTE35Mode Sets how the SCTE-35 data of the chunks (Chunk.SCTE35) is written before them
+func (p *Hls) SetSCTE35Mode(scte35Mode SCTE35Modes) {
+	p.scte35Mode = scte35Mode
+}
+
+// scte35String Returns the SCTE-35 marker lines of the chunk at index ("" if none)
+func (p *Hls) scte35String(chunk Chunk, index int) string {
+	if chunk.SCTE35 == nil {
+		return ""
+	}
+
+	if p.scte35Mode == SCTE35DateRange && !chunk.ProgramDateTime.IsZero() {
+		dateRange := DateRange{ID: p.scte35DateRangeID(chunk, index), StartDate: chunk.ProgramDateTime, SCTE35Out: chunk.SCTE35}
+		return dateRange.String()
+	}
+
+	return "#EXT-OATCLS-SCTE35:" + base64.StdEncoding.EncodeToString(chunk.SCTE35) + "\n#EXT-X-CUE-OUT\n"
+}
+
+// scte35DateRangeID Returns the date range ID of the SCTE-35 marker of the chunk at index: from its filename,
+// or from its media sequence number if it has none (ex: inline chunk)
+func (p *Hls) scte35DateRangeID(chunk Chunk, index int) string {
+	if chunk.FileName == "" {
+		return "scte35-" + strconv.FormatInt(p.mediaSequence()+int64(index), 10)
+	}
+
+	return "scte35-" + path.Base(chunk.FileName)
+}
@@ -0,0 +1,55 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHlsChunkSCTE35DateRange(t *testing.T) {
+	pdt := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, ProgramDateTime: pdt}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, ProgramDateTime: pdt.Add(4 * time.Second), SCTE35: []byte{0xFC, 0x30, 0x11}}, false)
+
+	xpectedChunkStr := `#EXT-X-PROGRAM-DATE-TIME:2020-01-01T10:00:04.000Z
+#EXT-X-DATERANGE:ID="scte35-chunk_00001.ts",START-DATE="2020-01-01T10:00:04.000Z",SCTE35-OUT=0xFC3011
+#EXTINF:4.00000000,
+chunk_00001.ts
+`
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, xpectedChunkStr) {
+		t.Errorf("SCTE-35 marker is not correct, got %s, want %s", manifestStr, xpectedChunkStr)
+	}
+	if count := strings.Count(h.String(), "#EXT-X-DATERANGE"); count != 1 {
+		t.Errorf("Number of date ranges is not correct, got %d, want %d", count, 1)
+	}
+}
+
+func TestHlsChunkSCTE35DateRangeInline(t *testing.T) {
+	pdt := time.Date(2020, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 3)
+	h.mseq = 10
+	h.AddChunk(Chunk{InlineData: []byte{0x47}, DurationS: 4.0, ProgramDateTime: pdt, SCTE35: []byte{0xFC, 0x30, 0x11}}, false)
+	h.AddChunk(Chunk{InlineData: []byte{0x47}, DurationS: 4.0, ProgramDateTime: pdt.Add(4 * time.Second), SCTE35: []byte{0xFC, 0x30, 0x11}}, false)
+
+	manifestStr := h.String()
+	for _, xpectedID := range []string{"ID=\"scte35-10\"", "ID=\"scte35-11\""} {
+		if !strings.Contains(manifestStr, xpectedID) {
+			t.Errorf("SCTE-35 date range ID is not correct, got %s, want %s", manifestStr, xpectedID)
+		}
+	}
+}
+
+func TestHlsChunkSCTE35CueOut(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetSCTE35Mode(SCTE35CueOut)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, SCTE35: []byte{0xFC, 0x30, 0x11}}, false)
+
+	xpectedChunkStr := "chunk_00000.ts\n#EXT-OATCLS-SCTE35:/DAR\n#EXT-X-CUE-OUT\n#EXTINF:4.00000000,\nchunk_00001.ts\n"
+	if manifestStr := h.String(); !strings.HasSuffix(manifestStr, xpectedChunkStr) {
+		t.Errorf("SCTE-35 marker is not correct, got %s, want %s", manifestStr, xpectedChunkStr)
+	}
+}
@@ -0,0 +1,161 @@
+package hls
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	// GzipSinkSuffix Suffix added to the filename of the gzip sinks
+	GzipSinkSuffix = ".gz"
+
+	// MainOutputName Name of the configured output type in the pre-publish hook
+	MainOutputName = "main"
+)
+
+var (
+	// ErrSinkNoHTTPClient HTTP or WebDAV sink added to a chunklist created without HTTP client
+	ErrSinkNoHTTPClient = errors.New("HTTP or WebDAV sink without HTTP client")
+
+	// ErrSinkDuplicate Sink that writes the same target as the main output
+	ErrSinkDuplicate = errors.New("sink duplicates the main output")
+)
+
+// Sink Additional output of the chunklist (ex: a local file copy besides the HTTP upload)
+type Sink struct {
+	// Name Identifies the sink in the pre-publish hook, "" uses its position (ex: "sink0" for the 1st added sink)
+	Name       string
+	OutputType OutputTypes
+	// FileName Path (file) or object key (HTTP, WebDAV) of the chunklist in this output, "" uses the chunklist filename
+	FileName string
+	// Version Renders the chunklist at this version for this output, raised to the one required by the tags
+	// in use (0 uses the chunklist version). Ex: integer #EXTINF durations at version <= 2 (see SetIntegerDurations),
+	// no delta updates below HlsVersionSkip
+	Version int
+	// Gzip Compresses the chunklist and adds GzipSinkSuffix to the filename (ex: chunklist.m3u8.gz)
+	Gzip bool
+}
+
+// AddSink Adds an output that receives each published chunklist under its own name, after the configured
+// output type. HTTP and WebDAV sinks use the configured client, scheme and host: ErrSinkNoHTTPClient is returned
+// if there is no client. A sink that writes the same target as the main output returns ErrSinkDuplicate.
+// The sinks are written on each save: the file flush interval, the audit writer and the last publish time
+// only apply to the main output (see SetFileFlushInterval, SetAuditWriter)
+func (p *Hls) AddSink(sink Sink) error {
+	if (sink.OutputType == HlsOutputModeHTTP || sink.OutputType == HlsOutputModeWebDAV) && p.httpClient == nil {
+		return ErrSinkNoHTTPClient
+	}
+	if p.isMainTarget(sink) {
+		return ErrSinkDuplicate
+	}
+
+	p.sinks = append(p.sinks, sink)
+
+	return nil
+}
+
+// isMainTarget Returns true if the sink writes the same chunklist to the same target as the main output
+func (p *Hls) isMainTarget(sink Sink) bool {
+	if sink.OutputType != p.outputType || sink.Gzip {
+		return false
+	}
+	// The writer receives every chunklist, a sink at another version only adds its own
+	if sink.OutputType == HlsOutputModeWriter {
+		return sink.Version == 0
+	}
+
+	return sink.FileName == "" || sink.FileName == p.chunklistFileName
+}
+
+// SetPrePublish Sets a function called with the rendered chunklist before each save, sinkName is MainOutputName for the
+// configured output type or the name of the sink (see Sink.Name). The returned bytes are saved instead (ex: to append
+// a signature comment), they are compressed afterwards for the gzip sinks. An error aborts the save to that output
+// and is returned
+func (p *Hls) SetPrePublish(prePublish func(sinkName string, data []byte) ([]byte, error)) {
+	p.prePublish = prePublish
+}
+
+// publishSinks Saves a rendered chunklist to all the sinks, the first error is returned once all are tried
+func (p *Hls) publishSinks(manifestByte []byte, transferMode TransferModes) error {
+	ret := error(nil)
+
+	for i, sink := range p.sinks {
+		fileName := sink.FileName
+		if fileName == "" {
+			fileName = p.chunklistFileName
+		}
+
+		sinkManifestByte := manifestByte
+		if sink.Version > 0 {
+			sinkManifestByte = []byte(p.versionString(sink.Version))
+		}
+
+		err := p.saveSink(sink, sinkName(sink, i), fileName, sinkManifestByte, transferMode)
+		if err != nil && ret == nil {
+			ret = err
+		}
+	}
+
+	return ret
+}
+
+// saveSink Saves a rendered chunklist to a sink, through the pre-publish hook then the compression
+func (p *Hls) saveSink(sink Sink, name string, fileName string, manifestByte []byte, transferMode TransferModes) error {
+	manifestByte, err := p.prePublished(sink.OutputType, name, fileName, manifestByte)
+	if err != nil {
+		return err
+	}
+
+	if sink.Gzip {
+		manifestByte, err = gzipManifest(manifestByte)
+		if err != nil {
+			p.log.Error("Error compressing ", fileName, ". Error: ", err)
+			return err
+		}
+		if !strings.HasSuffix(fileName, GzipSinkSuffix) {
+			fileName = fileName + GzipSinkSuffix
+		}
+	}
+
+	return p.writeManifest(sink.OutputType, fileName, manifestByte, transferMode)
+}
+
+// sinkName Returns the name of the sink i in the pre-publish hook
+func sinkName(sink Sink, i int) string {
+	if sink.Name != "" {
+		return sink.Name
+	}
+
+	return "sink" + strconv.Itoa(i)
+}
+
+// versionString Returns the chunklist rendered at version, or at the required version if it is higher.
+// Below the chunklist version the optional tags that need a higher one are omitted (ex: CAN-SKIP-UNTIL before 9)
+func (p *Hls) versionString(version int) string {
+	if requiredVersion := p.requiredVersion(); version < requiredVersion {
+		version = requiredVersion
+	}
+
+	ctx := p.newRenderContext(version)
+	ctx.stripTags = version < p.EffectiveVersion()
+
+	return p.render(ctx, 0)
+}
+
+// gzipManifest Returns the gzip compressed chunklist
+func gzipManifest(manifestByte []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(manifestByte); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,356 @@
+package hls
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHlsSinksFileNames(t *testing.T) {
+	uploads := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		uploads[r.Method+" "+r.URL.Path] = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	dir, err := ioutil.TempDir("", "hls-sinks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, chunklistFileName, "", HlsOutputModeFile, server.Client(), serverURL.Scheme, serverURL.Host)
+
+	writer := &bytes.Buffer{}
+	h.SetOutputWriter(writer, "")
+	h.AddSink(Sink{OutputType: HlsOutputModeHTTP, FileName: "live/abc/chunklist.m3u8"})
+	h.AddSink(Sink{OutputType: HlsOutputModeFile, FileName: path.Join(dir, "copy.m3u8")})
+	h.AddSink(Sink{OutputType: HlsOutputModeWriter})
+
+	if err := h.AddChunk(Chunk{FileName: "chunk_00000.ts", DurationS: 4.0}, true); err != nil {
+		t.Fatalf("Unexpected error publishing, got %v", err)
+	}
+
+	xpectedManifest := readFileString(t, chunklistFileName)
+
+	if len(uploads) != 1 || uploads["POST /live/abc/chunklist.m3u8"] != xpectedManifest {
+		t.Errorf("HTTP sink upload is not correct, got %v, want POST /live/abc/chunklist.m3u8", uploads)
+	}
+	if copyManifest := readFileString(t, path.Join(dir, "copy.m3u8")); copyManifest != xpectedManifest {
+		t.Errorf("File sink manifest is not correct, got %s, want %s", copyManifest, xpectedManifest)
+	}
+	if writer.String() != xpectedManifest+DefaultOutputWriterDelimiter {
+		t.Errorf("Writer sink manifest is not correct, got %s, want %s", writer.String(), xpectedManifest+DefaultOutputWriterDelimiter)
+	}
+}
+
+func TestHlsSinksError(t *testing.T) {
+	h := newTestHls(LiveEvent, 0)
+	h.AddSink(Sink{OutputType: HlsOutputModeWriter})
+
+	// The writer sink is not configured, the error is reported even if the output is none
+	if err := h.AddChunk(Chunk{FileName: "chunk_00000.ts", DurationS: 4.0}, true); err != ErrOutputWriterNotSet {
+		t.Errorf("Sink error is not correct, got %v, want %v", err, ErrOutputWriterNotSet)
+	}
+}
+
+func TestHlsSinksRejected(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeFile, nil, "", "")
+
+	if err := h.AddSink(Sink{OutputType: HlsOutputModeHTTP, FileName: "live/chunklist.m3u8"}); err != ErrSinkNoHTTPClient {
+		t.Errorf("HTTP sink error is not correct, got %v, want %v", err, ErrSinkNoHTTPClient)
+	}
+	if err := h.AddSink(Sink{OutputType: HlsOutputModeWebDAV}); err != ErrSinkNoHTTPClient {
+		t.Errorf("WebDAV sink error is not correct, got %v, want %v", err, ErrSinkNoHTTPClient)
+	}
+	if err := h.AddSink(Sink{OutputType: HlsOutputModeFile}); err != ErrSinkDuplicate {
+		t.Errorf("Duplicate sink error is not correct, got %v, want %v", err, ErrSinkDuplicate)
+	}
+	if err := h.AddSink(Sink{OutputType: HlsOutputModeFile, FileName: "results/chunklist.m3u8"}); err != ErrSinkDuplicate {
+		t.Errorf("Duplicate sink error is not correct, got %v, want %v", err, ErrSinkDuplicate)
+	}
+	if len(h.sinks) != 0 {
+		t.Errorf("Number of sinks is not correct, got %d, want %d", len(h.sinks), 0)
+	}
+
+	// Same filename compressed is another target
+	if err := h.AddSink(Sink{OutputType: HlsOutputModeFile, Gzip: true}); err != nil {
+		t.Errorf("Unexpected error adding gzip sink, got %v", err)
+	}
+}
+
+func TestHlsSinksAfterMainOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls-sinks-order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// The main output fails (missing directory), the sink is not written
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, path.Join(dir, "missing", "chunklist.m3u8"), "", HlsOutputModeFile, nil, "", "")
+	h.AddSink(Sink{OutputType: HlsOutputModeFile, FileName: path.Join(dir, "copy.m3u8")})
+
+	if err := h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true); err == nil {
+		t.Errorf("Expected a main output error")
+	}
+	if _, err := os.Stat(path.Join(dir, "copy.m3u8")); !os.IsNotExist(err) {
+		t.Errorf("Sink manifest should not be written, got %v", err)
+	}
+}
+
+func TestHlsSinksNotBuffered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls-sinks-flush")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+	audit := &bytes.Buffer{}
+
+	h := New(logrus.New(), LiveEvent, 3, false, 4.0, 0, chunklistFileName, "", HlsOutputModeFile, nil, "", "")
+	h.SetClock(clock.Now)
+	h.SetFileFlushInterval(time.Minute)
+	h.SetAuditWriter(audit)
+	h.AddSink(Sink{OutputType: HlsOutputModeFile, FileName: path.Join(dir, "copy.m3u8")})
+
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true)
+	firstManifestStr := h.String()
+	h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00001.ts"), DurationS: 4.0}, true)
+
+	// The main output is buffered and audited once, the sink has the last chunklist
+	if manifestStr := readFileString(t, chunklistFileName); manifestStr != firstManifestStr {
+		t.Errorf("Main chunklist is not correct, got %s, want %s", manifestStr, firstManifestStr)
+	}
+	if copyManifest := readFileString(t, path.Join(dir, "copy.m3u8")); copyManifest != h.String() {
+		t.Errorf("Sink manifest is not correct, got %s, want %s", copyManifest, h.String())
+	}
+	if audits := strings.Count(audit.String(), "#EXTM3U\n"); audits != 1 {
+		t.Errorf("Number of audited chunklists is not correct, got %d, want %d", audits, 1)
+	}
+}
+
+func TestHlsSinksGzip(t *testing.T) {
+	uploads := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		uploads[r.URL.Path] = string(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	dir, err := ioutil.TempDir("", "hls-sinks-gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "live/chunklist.m3u8", "", HlsOutputModeHTTP, server.Client(), serverURL.Scheme, serverURL.Host)
+	h.AddSink(Sink{OutputType: HlsOutputModeFile, FileName: path.Join(dir, "chunklist.m3u8"), Gzip: true})
+
+	if err := h.AddChunk(Chunk{FileName: "chunk_00000.ts", DurationS: 4.0}, true); err != nil {
+		t.Fatalf("Unexpected error publishing, got %v", err)
+	}
+
+	xpectedManifest := uploads["/live/chunklist.m3u8"]
+	if !strings.HasPrefix(xpectedManifest, "#EXTM3U\n") {
+		t.Fatalf("HTTP body is not plain text, got %q", xpectedManifest)
+	}
+
+	f, err := os.Open(path.Join(dir, "chunklist.m3u8.gz"))
+	if err != nil {
+		t.Fatalf("Gzip file sink not written, got %v", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Gzip file sink is not valid gzip, got %v", err)
+	}
+	gzipManifest, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Gzip file sink is not valid gzip, got %v", err)
+	}
+
+	if string(gzipManifest) != xpectedManifest {
+		t.Errorf("Gzip file sink manifest is not correct, got %s, want %s", gzipManifest, xpectedManifest)
+	}
+}
+
+func TestHlsSinksPrePublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls-sinks-prepublish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "live/chunklist.m3u8", "", HlsOutputModeWriter, nil, "", "")
+
+	writer := &bytes.Buffer{}
+	h.SetOutputWriter(writer, "")
+	h.AddSink(Sink{Name: "signed", OutputType: HlsOutputModeFile, FileName: path.Join(dir, "signed.m3u8")})
+	h.AddSink(Sink{Name: "rejected", OutputType: HlsOutputModeFile, FileName: path.Join(dir, "rejected.m3u8")})
+	h.AddSink(Sink{OutputType: HlsOutputModeFile, FileName: path.Join(dir, "unnamed.m3u8")})
+
+	errRejected := errors.New("rejected")
+	h.SetPrePublish(func(sinkName string, data []byte) ([]byte, error) {
+		if sinkName == "rejected" {
+			return nil, errRejected
+		}
+		return append(data, []byte("#SIGNATURE:"+sinkName+"\n")...), nil
+	})
+
+	if err := h.AddChunk(Chunk{FileName: "live/chunk_00000.ts", DurationS: 4.0}, true); err != errRejected {
+		t.Errorf("Publish error is not correct, got %v, want %v", err, errRejected)
+	}
+
+	manifestStr := h.String()
+
+	xpectedWriter := manifestStr + "#SIGNATURE:" + MainOutputName + "\n" + DefaultOutputWriterDelimiter
+	if writer.String() != xpectedWriter {
+		t.Errorf("Writer manifest is not correct, got %s, want %s", writer.String(), xpectedWriter)
+	}
+
+	xpectedSigned := manifestStr + "#SIGNATURE:signed\n"
+	if signedManifest := readFileString(t, path.Join(dir, "signed.m3u8")); signedManifest != xpectedSigned {
+		t.Errorf("Signed sink manifest is not correct, got %s, want %s", signedManifest, xpectedSigned)
+	}
+	xpectedUnnamed := manifestStr + "#SIGNATURE:sink2\n"
+	if unnamedManifest := readFileString(t, path.Join(dir, "unnamed.m3u8")); unnamedManifest != xpectedUnnamed {
+		t.Errorf("Unnamed sink manifest is not correct, got %s, want %s", unnamedManifest, xpectedUnnamed)
+	}
+
+	if _, err := os.Stat(path.Join(dir, "rejected.m3u8")); !os.IsNotExist(err) {
+		t.Errorf("Rejected sink manifest should not be written, got %v", err)
+	}
+}
+
+func TestHlsSinksPrePublishGzip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls-sinks-prepublish-gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, path.Join(dir, "chunklist.m3u8"), "", HlsOutputModeFile, nil, "", "")
+	h.AddSink(Sink{Name: "gzip", OutputType: HlsOutputModeFile, Gzip: true})
+
+	// The hook signs the plain text, the gzip sink is compressed afterwards
+	h.SetPrePublish(func(sinkName string, data []byte) ([]byte, error) {
+		return append(data, []byte("#SIGNATURE:"+sinkName+"\n")...), nil
+	})
+
+	if err := h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true); err != nil {
+		t.Fatalf("Unexpected error publishing, got %v", err)
+	}
+
+	xpectedManifest := h.String() + "#SIGNATURE:gzip\n"
+	if mainManifest := readFileString(t, path.Join(dir, "chunklist.m3u8")); mainManifest != h.String()+"#SIGNATURE:"+MainOutputName+"\n" {
+		t.Errorf("Main manifest is not correct, got %s", mainManifest)
+	}
+
+	f, err := os.Open(path.Join(dir, "chunklist.m3u8"+GzipSinkSuffix))
+	if err != nil {
+		t.Fatalf("Gzip file sink not written, got %v", err)
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("Gzip file sink is not valid gzip, got %v", err)
+	}
+	gzipManifest, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatalf("Gzip file sink is not valid gzip, got %v", err)
+	}
+	if string(gzipManifest) != xpectedManifest {
+		t.Errorf("Gzip file sink manifest is not correct, got %s, want %s", gzipManifest, xpectedManifest)
+	}
+}
+
+func TestHlsSinksVersion(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 6, false, 4.0, 3, "live/chunklist.m3u8", "", HlsOutputModeWriter, nil, "", "")
+	h.SetIntegerDurations(true)
+
+	writer := &bytes.Buffer{}
+	h.SetOutputWriter(writer, "\n")
+	if err := h.AddSink(Sink{OutputType: HlsOutputModeWriter}); err != ErrSinkDuplicate {
+		t.Errorf("Duplicate sink error is not correct, got %v, want %v", err, ErrSinkDuplicate)
+	}
+	h.AddSink(Sink{OutputType: HlsOutputModeWriter, Version: 2})
+	h.AddSink(Sink{OutputType: HlsOutputModeWriter, Version: 3})
+
+	if err := h.AddChunk(Chunk{FileName: "live/chunk_00000.ts", DurationS: 4.0}, true); err != nil {
+		t.Fatalf("Unexpected error publishing, got %v", err)
+	}
+
+	// The main output first, then the sinks
+	manifests := strings.Split(strings.TrimSuffix(writer.String(), "\n\n"), "\n\n")
+	xpectedVersions := []string{"#EXT-X-VERSION:6\n", "#EXT-X-VERSION:2\n", "#EXT-X-VERSION:3\n"}
+	xpectedExtinfs := []string{"#EXTINF:4.00000000,\n", "#EXTINF:4,\n", "#EXTINF:4.00000000,\n"}
+	if len(manifests) != len(xpectedVersions) {
+		t.Fatalf("Number of manifests is not correct, got %d, want %d", len(manifests), len(xpectedVersions))
+	}
+	for i, manifest := range manifests {
+		if !strings.Contains(manifest, xpectedVersions[i]) || !strings.Contains(manifest, xpectedExtinfs[i]) {
+			t.Errorf("Manifest %d is not correct, got %s, want %s and %s", i, manifest, xpectedVersions[i], xpectedExtinfs[i])
+		}
+	}
+
+	// The version is raised to the one required by #EXT-X-MAP
+	h.SetInitChunk("live/init.mp4")
+	if manifestStr := h.versionString(3); !strings.Contains(manifestStr, "#EXT-X-VERSION:6\n") {
+		t.Errorf("Version is not raised to the required one, got %s, want %s", manifestStr, "#EXT-X-VERSION:6")
+	}
+	if version := h.EffectiveVersion(); version != 6 {
+		t.Errorf("Effective version is not correct after a sink render, got %d, want %d", version, 6)
+	}
+}
+
+func TestHlsSinksVersionStripTags(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, HlsVersionSkip, false, 4.0, 10, "live/chunklist.m3u8", "", HlsOutputModeWriter, nil, "", "")
+	h.SetCanSkipUntil(24.0)
+
+	writer := &bytes.Buffer{}
+	h.SetOutputWriter(writer, "\n")
+	h.AddSink(Sink{OutputType: HlsOutputModeWriter, Version: HlsVersionMap})
+	h.AddSink(Sink{OutputType: HlsOutputModeWriter, Version: HlsVersionSkip})
+
+	if err := h.AddChunk(Chunk{FileName: "live/chunk_00000.ts", DurationS: 4.0}, true); err != nil {
+		t.Fatalf("Unexpected error publishing, got %v", err)
+	}
+
+	// Delta updates are not advertised below version 9
+	manifests := strings.Split(strings.TrimSuffix(writer.String(), "\n\n"), "\n\n")
+	xpectedServerControls := []bool{true, false, true}
+	if len(manifests) != len(xpectedServerControls) {
+		t.Fatalf("Number of manifests is not correct, got %d, want %d", len(manifests), len(xpectedServerControls))
+	}
+	for i, manifest := range manifests {
+		if serverControl := strings.Contains(manifest, "#EXT-X-SERVER-CONTROL:CAN-SKIP-UNTIL=24.000\n"); serverControl != xpectedServerControls[i] {
+			t.Errorf("Manifest %d server control is not correct, got %s, want %v", i, manifest, xpectedServerControls[i])
+		}
+	}
+	if !strings.Contains(manifests[1], "#EXT-X-VERSION:6\n") {
+		t.Errorf("Manifest version is not correct, got %s, want %s", manifests[1], "#EXT-X-VERSION:6")
+	}
+}
@@ -0,0 +1,37 @@
+package hls
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stats Chunklist state summary (ex: for monitoring endpoints)
+type Stats struct {
+	MediaSequence         int64     `json:"media_sequence"`
+	DiscontinuitySequence int64     `json:"discontinuity_sequence"`
+	SegmentCount          int       `json:"segment_count"`
+	TotalDurationS        float64   `json:"total_duration"`
+	Closed                bool      `json:"closed"`
+	LastPublish           time.Time `json:"last_publish"`
+
+	// PublishedBytes Sum of the bytes written / uploaded by all the chunklist saves (main output and sinks)
+	PublishedBytes int64 `json:"published_bytes"`
+}
+
+// Stats Returns the current chunklist state summary
+func (p *Hls) Stats() Stats {
+	return Stats{
+		MediaSequence:         p.mediaSequence(),
+		DiscontinuitySequence: p.dseq,
+		SegmentCount:          len(p.chunks),
+		TotalDurationS:        p.TotalDuration(),
+		Closed:                p.isClosed,
+		LastPublish:           p.lastPublishTime,
+		PublishedBytes:        p.publishedBytes,
+	}
+}
+
+// StatsJSON Returns the current chunklist state summary as JSON (ex: for HTTP health checks)
+func (p *Hls) StatsJSON() ([]byte, error) {
+	return json.Marshal(p.Stats())
+}
@@ -0,0 +1,124 @@
+package hls
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHlsStatsJSON(t *testing.T) {
+	clock := &fakeClock{t: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+
+	h := newTestHls(LiveWindow, 3)
+	h.SetClock(clock.Now)
+	for i := 0; i < 5; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.5, IsDisco: i == 1}, false)
+	}
+	h.published(nil)
+	h.CloseManifest(false)
+
+	data, err := h.StatsJSON()
+	if err != nil {
+		t.Fatalf("Unexpected error, got %v", err)
+	}
+
+	stats := make(map[string]interface{})
+	if err := json.Unmarshal(data, &stats); err != nil {
+		t.Fatalf("Invalid JSON %s, got %v", data, err)
+	}
+
+	xpectedStats := map[string]interface{}{
+		"media_sequence":         2.0,
+		"discontinuity_sequence": 1.0,
+		"segment_count":          3.0,
+		"total_duration":         13.5,
+		"closed":                 true,
+		"last_publish":           "2020-01-01T00:00:01Z",
+	}
+	for field, xpectedValue := range xpectedStats {
+		if stats[field] != xpectedValue {
+			t.Errorf("Field %s is not correct, got %v, want %v", field, stats[field], xpectedValue)
+		}
+	}
+}
+
+func TestHlsPublishedBytes(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeWriter, nil, "", "")
+	h.SetOutputWriter(ioutil.Discard, "")
+
+	reportedSizes := make([]int, 0)
+	h.SetPublishCallback(func(sizeBytes int) {
+		reportedSizes = append(reportedSizes, sizeBytes)
+	})
+
+	xpectedSizes := make([]int, 0)
+	xpectedTotal := int64(0)
+	for i := 0; i < 4; i++ {
+		if err := h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, true); err != nil {
+			t.Fatalf("Unexpected error publishing, got %v", err)
+		}
+		xpectedSizes = append(xpectedSizes, len(h.String()))
+		xpectedTotal += int64(len(h.String()))
+	}
+
+	if len(reportedSizes) != len(xpectedSizes) {
+		t.Fatalf("Number of publishes is not correct, got %d, want %d", len(reportedSizes), len(xpectedSizes))
+	}
+	for i := range xpectedSizes {
+		if reportedSizes[i] != xpectedSizes[i] {
+			t.Errorf("Published bytes %d are not correct, got %d, want %d", i, reportedSizes[i], xpectedSizes[i])
+		}
+	}
+	if stats := h.Stats(); stats.PublishedBytes != xpectedTotal {
+		t.Errorf("Total published bytes are not correct, got %d, want %d", stats.PublishedBytes, xpectedTotal)
+	}
+}
+
+func TestHlsPublishedBytesPerOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatalf("Unexpected error creating temp dir, got %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, path.Join(dir, "chunklist.m3u8"), "", HlsOutputModeWriter, nil, "", "")
+	h.SetOutputWriter(ioutil.Discard, "")
+	h.AddSink(Sink{OutputType: HlsOutputModeFile, Gzip: true})
+	signature := "#SIGNATURE:abc\n"
+	h.SetPrePublish(func(sinkName string, data []byte) ([]byte, error) {
+		return append(append([]byte(nil), data...), signature...), nil
+	})
+
+	reportedTotal := int64(0)
+	reportedCount := 0
+	h.SetPublishCallback(func(sizeBytes int) {
+		reportedTotal += int64(sizeBytes)
+		reportedCount++
+	})
+
+	if err := h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: 4.0}, true); err != nil {
+		t.Fatalf("Unexpected error publishing, got %v", err)
+	}
+
+	// The main output with the signature and the compressed sink file
+	gzipInfo, err := os.Stat(path.Join(dir, "chunklist.m3u8"+GzipSinkSuffix))
+	if err != nil {
+		t.Fatalf("Unexpected error reading the sink, got %v", err)
+	}
+	xpectedTotal := int64(len(h.String())+len(signature)) + gzipInfo.Size()
+	if reportedCount != 2 {
+		t.Errorf("Number of publishes is not correct, got %d, want %d", reportedCount, 2)
+	}
+	if reportedTotal != xpectedTotal {
+		t.Errorf("Reported published bytes are not correct, got %d, want %d", reportedTotal, xpectedTotal)
+	}
+	if stats := h.Stats(); stats.PublishedBytes != xpectedTotal {
+		t.Errorf("Total published bytes are not correct, got %d, want %d", stats.PublishedBytes, xpectedTotal)
+	}
+}
@@ -0,0 +1,28 @@
+package hls
+
+// TimelineEntry Position of a chunk in the chunklist timeline (ex: for scrubbing UIs)
+type TimelineEntry struct {
+	// StartS Offset of the chunk start from the 1st chunk of the chunklist
+	StartS float64
+
+	// EndS Offset of the chunk end (cumulative durations)
+	EndS float64
+
+	FileName string
+	IsDisco  bool
+}
+
+// Timeline Returns the start and end offsets of the chunks, the timeline is continuous across discontinuities
+func (p *Hls) Timeline() []TimelineEntry {
+	ret := make([]TimelineEntry, 0, len(p.chunks))
+
+	var offsetS durationAccumulator
+	for _, chunk := range p.chunks {
+		startS := offsetS.Sum()
+		offsetS.Add(chunk.DurationS)
+
+		ret = append(ret, TimelineEntry{StartS: startS, EndS: offsetS.Sum(), FileName: chunk.FileName, IsDisco: chunk.IsDisco})
+	}
+
+	return ret
+}
@@ -0,0 +1,34 @@
+package hls
+
+import (
+	"testing"
+)
+
+func TestHlsTimeline(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 3.5}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.ts", DurationS: 2.0, IsDisco: true}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00003.ts", DurationS: 4.0}, false)
+
+	// The 1st chunk is evicted, offsets are from the 1st chunk of the window
+	xpectedTimeline := []TimelineEntry{
+		{StartS: 0.0, EndS: 3.5, FileName: "results/chunk_00001.ts"},
+		{StartS: 3.5, EndS: 5.5, FileName: "results/chunk_00002.ts", IsDisco: true},
+		{StartS: 5.5, EndS: 9.5, FileName: "results/chunk_00003.ts"},
+	}
+
+	timeline := h.Timeline()
+	if len(timeline) != len(xpectedTimeline) {
+		t.Fatalf("Number of timeline entries is not correct, got %d, want %d", len(timeline), len(xpectedTimeline))
+	}
+	for i, xpectedEntry := range xpectedTimeline {
+		if timeline[i] != xpectedEntry {
+			t.Errorf("Timeline entry %d is not correct, got %v, want %v", i, timeline[i], xpectedEntry)
+		}
+	}
+
+	if empty := newTestHls(LiveWindow, 3); len(empty.Timeline()) != 0 {
+		t.Errorf("Timeline of an empty chunklist is not correct, got %v, want empty", empty.Timeline())
+	}
+}
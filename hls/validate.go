@@ -0,0 +1,136 @@
+package hls
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+const (
+	// HlsVersionFloatDuration Minimum version for decimal #EXTINF durations
+	HlsVersionFloatDuration = 3
+
+	// HlsVersionMap Minimum version for #EXT-X-MAP in a media playlist
+	HlsVersionMap = 6
+
+	// HlsVersionSkip Minimum version for the playlist delta updates (#EXT-X-SKIP, CAN-SKIP-UNTIL)
+	HlsVersionSkip = 9
+)
+
+// ValidationError Aggregates all the problems found validating a chunklist or master playlist
+type ValidationError struct {
+	Errors []error
+}
+
+// Error Returns all the problems in one line
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+
+	return "invalid playlist: " + strings.Join(msgs, "; ")
+}
+
+// SetStrictMode Enables RFC 8216 compliance mode: auto version bump and a Validate call
+// before each publish (the chunklist is not saved if it fails). Target duration is always a ceiling
+func (p *Hls) SetStrictMode(strictMode bool) {
+	p.strictMode = strictMode
+}
+
+// SetRejectQuotes Refuses the values written as quoted attributes that contain double quotes: AddChunk (init and part
+// filenames), AddPart and AddDateRange return ErrQuotedAttribute, the init chunk is reported as a Validate error.
+// Quoted attributes are always rendered percent encoded, so the chunklist lines are never broken
+func (p *Hls) SetRejectQuotes(rejectQuotes bool) {
+	p.rejectQuotes = rejectQuotes
+}
+
+// SetV3Compat Enables HLS v3 compatibility: fMP4 chunks and init chunks (#EXT-X-MAP needs version 6) are refused
+// by AddChunk with ErrV3CompatFMP4 and reported by Validate, instead of rendering a MAP that v3 players ignore
+func (p *Hls) SetV3Compat(v3Compat bool) {
+	p.v3Compat = v3Compat
+}
+
+// SetMaxLineLength Sets the maximum length of a rendered line checked by Validate (0 means no limit)
+func (p *Hls) SetMaxLineLength(maxLineLength int) {
+	p.maxLineLength = maxLineLength
+}
+
+// requiredVersion Returns the minimum version needed by the tags used in the chunklist
+func (p *Hls) requiredVersion() int {
+	ret := HlsVersionFloatDuration
+	if p.integerDurations && p.allWholeDurations() {
+		ret = 1
+	}
+
+	for _, chunk := range p.chunks {
+		for _, key := range chunk.Keys {
+			if key.KeyFormat != "" || key.KeyFormatVersions != "" {
+				ret = HlsVersionKeyFormat
+			}
+		}
+	}
+
+	if p.initChunkDataFileName != "" {
+		ret = HlsVersionMap
+	}
+	for _, chunk := range p.chunks {
+		if chunk.InitFileName != "" {
+			ret = HlsVersionMap
+		}
+	}
+
+	return ret
+}
+
+// EffectiveVersion Returns the version that is rendered: the configured one, or in strict mode
+// the max of the configured one and the one required by the tags in use (ex: #EXT-X-MAP needs 6)
+func (p *Hls) EffectiveVersion() int {
+	if p.strictMode && p.version < p.requiredVersion() {
+		return p.requiredVersion()
+	}
+
+	return p.version
+}
+
+func isFragmentedMP4(fileName string) bool {
+	ext := strings.ToLower(path.Ext(fileName))
+
+	return ext == ".mp4" || ext == ".m4s" || ext == ".cmfv" || ext == ".cmfa"
+}
+
+// Validate Checks the chunklist against RFC 8216 and returns all the problems found as a *ValidationError
+func (p *Hls) Validate() error {
+	errs := make([]error, 0)
+
+	for _, issue := range p.Lint() {
+		if issue.Severity == IssueError {
+			errs = append(errs, errors.New(issue.Message))
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+
+	return nil
+}
+
+// CheckNegativeDiscontinuitySequence Checks that the discontinuity sequence is not negative, the only invalid value
+// (any other one is possible whatever the media sequence, ex: restarted packager that kept counting).
+// Returns false if it is negative, and if repair is set it is reset to 0
+func (p *Hls) CheckNegativeDiscontinuitySequence(repair bool) bool {
+	if p.dseq >= 0 {
+		return true
+	}
+
+	if !repair {
+		p.log.Warn("Discontinuity sequence ", p.dseq, " is negative in ", p.chunklistFileName)
+		return false
+	}
+
+	p.log.Warn("Discontinuity sequence ", p.dseq, " is negative in ", p.chunklistFileName, ", repaired to 0")
+	p.dseq = 0
+
+	return false
+}
@@ -0,0 +1,305 @@
+package hls
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHlsValidateStrictModeSeveralViolations(t *testing.T) {
+	pdt := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	h := newTestHls(LiveWindow, 5)
+	// Strict mode is enabled after adding since it rejects fMP4 chunks without init
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0, ProgramDateTime: pdt}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: -1.0, ProgramDateTime: pdt.Add(-time.Second)}, false)
+	h.SetStrictMode(true)
+
+	err := h.Validate()
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a *ValidationError, got %v", err)
+	}
+
+	// 2 fMP4 without init, 1 negative duration, 1 non monotonic PDT
+	xpectedErrors := 4
+	if len(validationErr.Errors) != xpectedErrors {
+		t.Errorf("Number of errors is not correct, got %d (%v), want %d", len(validationErr.Errors), validationErr, xpectedErrors)
+	}
+
+	for _, xpectedMsg := range []string{"negative duration", "no init chunk", "not monotonic"} {
+		if !strings.Contains(validationErr.Error(), xpectedMsg) {
+			t.Errorf("Error %q not found in %s", xpectedMsg, validationErr.Error())
+		}
+	}
+}
+
+func TestHlsValidateVersion(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.SetInitChunk("results/init00000.ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "version 3 is lower than required 6") {
+		t.Errorf("Expected a version error, got %v", err)
+	}
+
+	// Strict mode bumps the version automatically
+	h.SetStrictMode(true)
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error in strict mode, got %v", err)
+	}
+	if manifestStr := h.String(); !strings.Contains(manifestStr, "#EXT-X-VERSION:6\n") {
+		t.Errorf("Version is not correct, got %s, want 6", manifestStr)
+	}
+}
+
+func TestHlsValidateStrictModeBlocksPublish(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	chunklistFileName := path.Join(dir, "chunklist.m3u8")
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, chunklistFileName, "", HlsOutputModeFile, nil, "", "")
+	h.SetStrictMode(true)
+
+	if err := h.AddChunk(Chunk{FileName: path.Join(dir, "chunk_00000.ts"), DurationS: -4.0}, true); err == nil {
+		t.Errorf("Expected a validation error")
+	}
+	if _, err := os.Stat(chunklistFileName); !os.IsNotExist(err) {
+		t.Errorf("Invalid chunklist should not be saved, got %v", err)
+	}
+}
+
+func TestHlsValidateMaxLineLength(t *testing.T) {
+	// 40 chars chunk URI, longer than any header line
+	chunkName := strings.Repeat("a", 37) + ".ts"
+
+	h := newTestHls(LiveWindow, 3)
+	h.AddChunk(Chunk{FileName: "results/" + chunkName, DurationS: 4.0}, false)
+
+	h.SetMaxLineLength(40)
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error for lines under the limit, got %v", err)
+	}
+
+	h.SetMaxLineLength(39)
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "line 7 length 40 exceeds maximum 39") {
+		t.Errorf("Expected a line length error, got %v", err)
+	}
+}
+
+func TestHlsEffectiveVersion(t *testing.T) {
+	h := newTestHls(LiveWindow, 5)
+	h.SetStrictMode(true)
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	if version := h.EffectiveVersion(); version != HlsVersionFloatDuration {
+		t.Errorf("Version is not correct, got %d, want %d", version, HlsVersionFloatDuration)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0, Keys: []Key{{Method: "SAMPLE-AES", URI: "skd://key1", KeyFormat: KeyFormatFairPlay}}}, false)
+	if version := h.EffectiveVersion(); version != HlsVersionKeyFormat {
+		t.Errorf("Version is not correct, got %d, want %d", version, HlsVersionKeyFormat)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00002.mp4", DurationS: 4.0, InitFileName: "results/init00000.mp4"}, false)
+	if version := h.EffectiveVersion(); version != HlsVersionMap {
+		t.Errorf("Version is not correct, got %d, want %d", version, HlsVersionMap)
+	}
+
+	// Configured version higher than the required one is kept
+	h.SetHlsVersion(7)
+	if version := h.EffectiveVersion(); version != 7 {
+		t.Errorf("Version is not correct, got %d, want %d", version, 7)
+	}
+
+	// Out of strict mode the configured version is rendered as is
+	h.SetStrictMode(false)
+	h.SetHlsVersion(3)
+	if version := h.EffectiveVersion(); version != 3 {
+		t.Errorf("Version is not correct, got %d, want %d", version, 3)
+	}
+}
+
+func TestHlsQuotedURIs(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetHlsVersion(HlsVersionMap)
+	h.SetInitChunk("results/init\"a\".ts")
+	h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+
+	// Escaped by default
+	xpectedMap := "#EXT-X-MAP:URI=\"init%22a%22.ts\"\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error with escaped quotes, got %v", err)
+	}
+
+	h.SetRejectQuotes(true)
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "contains a double quote") {
+		t.Errorf("Expected a quote error, got %v", err)
+	}
+	// Still escaped when rendered
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+}
+
+func TestHlsRejectQuotesAtAdd(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetHlsVersion(HlsVersionMap)
+	h.SetRejectQuotes(true)
+
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", InitFileName: "results/init\"a\".mp4", DurationS: 4.0}, false); err != ErrQuotedAttribute {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrQuotedAttribute)
+	}
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0, Parts: []Part{{FileName: "results/part\"0\".ts", DurationS: 1.0}}}, false); err != ErrQuotedAttribute {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrQuotedAttribute)
+	}
+	if len(h.chunks) != 0 {
+		t.Errorf("Number of chunks is not correct, got %d, want %d", len(h.chunks), 0)
+	}
+
+	if err := h.AddPart(Part{FileName: "results/part\"0\".ts", DurationS: 1.0}, false); err != ErrQuotedAttribute {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrQuotedAttribute)
+	}
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := h.AddDateRange(DateRange{ID: "ad\"1", StartDate: start}); err != ErrQuotedAttribute {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrQuotedAttribute)
+	}
+	if err := h.AddDateRange(DateRange{ID: "ad1", StartDate: start, ClientAttributes: map[string]interface{}{"X-COM-EXAMPLE-AD": "a\"b"}}); err != ErrQuotedAttribute {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrQuotedAttribute)
+	}
+}
+
+func TestEscapeQuotedAttributes(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := DateRange{ID: "ad\"1", Class: "com.example\nad", StartDate: start, ClientAttributes: map[string]interface{}{"X-COM-EXAMPLE-AD": "a\r\nb"}}
+	xpectedDateRange := "#EXT-X-DATERANGE:ID=\"ad%221\",CLASS=\"com.example%0Aad\""
+	if dateRangeStr := d.String(); !strings.HasPrefix(dateRangeStr, xpectedDateRange) || !strings.Contains(dateRangeStr, "X-COM-EXAMPLE-AD=\"a%0D%0Ab\"") {
+		t.Errorf("EXT-X-DATERANGE is not correct, got %s, want %s", dateRangeStr, xpectedDateRange)
+	}
+
+	r := Rendition{Type: RenditionAudio, GroupID: "aac", Name: "English \"main\"", URI: "audio_en.m3u8"}
+	xpectedRendition := "#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID=\"aac\",NAME=\"English %22main%22\",URI=\"audio_en.m3u8\"\n"
+	if renditionStr := r.String(); renditionStr != xpectedRendition {
+		t.Errorf("EXT-X-MEDIA is not correct, got %s, want %s", renditionStr, xpectedRendition)
+	}
+
+	c := ContentSteering{ServerURI: "https://example.com/steering\n", PathwayID: "CDN\"A"}
+	xpectedSteering := "#EXT-X-CONTENT-STEERING:SERVER-URI=\"https://example.com/steering%0A\",PATHWAY-ID=\"CDN%22A\"\n"
+	if steeringStr := c.String(); steeringStr != xpectedSteering {
+		t.Errorf("EXT-X-CONTENT-STEERING is not correct, got %s, want %s", steeringStr, xpectedSteering)
+	}
+}
+
+func TestHlsChunkBeforeInit(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetHlsVersion(HlsVersionMap)
+
+	// Out of strict mode it is added and the MAP is rendered once the init is set
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0}, false); err != nil {
+		t.Errorf("Unexpected error adding chunk, got %v", err)
+	}
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "no init chunk") {
+		t.Errorf("Expected an init error, got %v", err)
+	}
+
+	h.SetInitChunk("results/init00000.mp4")
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error once the init is set, got %v", err)
+	}
+	xpectedMap := "#EXT-X-MAP:URI=\"init00000.mp4\"\n#EXTINF:4.00000000,\nchunk_00000.m4s\n"
+	if manifestStr := h.String(); !strings.Contains(manifestStr, xpectedMap) {
+		t.Errorf("EXT-X-MAP is not correct, got %s, want %s", manifestStr, xpectedMap)
+	}
+
+	// Strict mode rejects it
+	s := newTestHls(LiveWindow, 3)
+	s.SetStrictMode(true)
+	if err := s.AddChunk(Chunk{FileName: "results/chunk_00000.m4s", DurationS: 4.0}, false); err != ErrChunkBeforeInit {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrChunkBeforeInit)
+	}
+	if len(s.chunks) != 0 {
+		t.Errorf("Number of chunks is not correct, got %d, want %d", len(s.chunks), 0)
+	}
+
+	// TS chunks do not need an init
+	if err := s.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false); err != nil {
+		t.Errorf("Unexpected error adding TS chunk, got %v", err)
+	}
+}
+
+func TestHlsValidateVodDuplicateFileNames(t *testing.T) {
+	h := newTestHls(Vod, 0)
+	for i := 0; i < 4; i++ {
+		h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, false)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error for unique filenames, got %v", err)
+	}
+
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00005.ts", DurationS: 4.0}, false)
+	h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false)
+
+	err := h.Validate()
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("Expected a *ValidationError, got %v", err)
+	}
+	xpectedErrors := []string{"chunk 4 (results/chunk_00001.ts) has the same filename as chunk 1", "chunk 6 (results/chunk_00001.ts) has the same filename as chunk 1"}
+	if len(validationErr.Errors) != len(xpectedErrors) {
+		t.Fatalf("Number of errors is not correct, got %d (%v), want %d", len(validationErr.Errors), validationErr, len(xpectedErrors))
+	}
+	for i, xpectedError := range xpectedErrors {
+		if validationErr.Errors[i].Error() != xpectedError {
+			t.Errorf("Error is not correct, got %v, want %s", validationErr.Errors[i], xpectedError)
+		}
+	}
+
+	// In a live chunklist it is only a warning
+	l := newTestHls(LiveWindow, 3)
+	l.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	l.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false)
+	if err := l.Validate(); err != nil {
+		t.Errorf("Unexpected error for a live chunklist, got %v", err)
+	}
+}
+
+func TestHlsV3Compat(t *testing.T) {
+	h := newTestHls(LiveWindow, 3)
+	h.SetV3Compat(true)
+
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, false); err != nil {
+		t.Errorf("Unexpected error adding TS chunk, got %v", err)
+	}
+	if err := h.Validate(); err != nil {
+		t.Errorf("Unexpected error for TS chunks, got %v", err)
+	}
+
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00001.m4s", DurationS: 4.0, InitFileName: "results/init00000.mp4"}, false); err != ErrV3CompatFMP4 {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrV3CompatFMP4)
+	}
+	h.SetInitChunk("results/init00000.ts")
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00001.ts", DurationS: 4.0}, false); err != ErrV3CompatFMP4 {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrV3CompatFMP4)
+	}
+	if len(h.chunks) != 1 {
+		t.Errorf("Number of chunks is not correct, got %d, want %d", len(h.chunks), 1)
+	}
+	if err := h.Validate(); err == nil || !strings.Contains(err.Error(), "not supported by HLS v3") {
+		t.Errorf("Expected a v3 error, got %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+package hls
+
+import (
+	"net/http"
+	"path"
+	"strings"
+)
+
+// SetWebDAVCreateParents Creates (MKCOL) the parent collections of the chunklist before the 1st upload in WebDAV output mode
+func (p *Hls) SetWebDAVCreateParents(webDAVCreateParents bool) {
+	p.webDAVCreateParents = webDAVCreateParents
+	p.webDAVParentsCreated = nil
+}
+
+// createWebDAVParents Creates the parent collections of fileName, from the top one.
+// Already existing collections (405) are fine
+func (p *Hls) createWebDAVParents(fileName string) error {
+	dir := path.Dir(fileName)
+	if dir == "." || dir == "/" {
+		return nil
+	}
+
+	collection := ""
+	for _, name := range strings.Split(strings.Trim(dir, "/"), "/") {
+		collection = collection + name + "/"
+
+		err := p.doHTTPRequest(p.newHTTPRequest("MKCOL", collection, nil, TransferModeContentLength), http.StatusMethodNotAllowed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *Hls) saveManifestToWebDAV(fileName string, manifestByte []byte, transferMode TransferModes) error {
+
+	if fileName != "" {
+		err := error(nil)
+		if p.webDAVCreateParents && !p.webDAVParentsCreated[fileName] {
+			err = p.createWebDAVParents(fileName)
+			if err == nil {
+				if p.webDAVParentsCreated == nil {
+					p.webDAVParentsCreated = map[string]bool{}
+				}
+				p.webDAVParentsCreated[fileName] = true
+			}
+		}
+
+		if err == nil {
+			err = p.doHTTPRequest(p.newHTTPRequest("PUT", fileName, manifestByte, transferMode))
+		}
+		if err != nil {
+			p.log.Error("Error uploading ", fileName, ". Error: ", err)
+			return err
+		}
+
+		p.log.Debug("Upload of ", fileName, " complete")
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package hls
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHlsWebDAVMethodSequence(t *testing.T) {
+	requests := make([]string, 0)
+	collections := map[string]bool{"/live/": true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+
+		if r.Method == "MKCOL" {
+			if collections[r.URL.Path] {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			collections[r.URL.Path] = true
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "live/stream1/chunklist.m3u8", "", HlsOutputModeWebDAV, server.Client(), serverURL.Scheme, serverURL.Host)
+	h.SetWebDAVCreateParents(true)
+
+	if err := h.AddChunk(Chunk{FileName: "live/stream1/chunk_00000.ts", DurationS: 4.0}, true); err != nil {
+		t.Errorf("Unexpected error publishing, got %v", err)
+	}
+	if err := h.AddChunk(Chunk{FileName: "live/stream1/chunk_00001.ts", DurationS: 4.0}, true); err != nil {
+		t.Errorf("Unexpected error publishing, got %v", err)
+	}
+
+	xpectedRequests := []string{"MKCOL /live/", "MKCOL /live/stream1/", "PUT /live/stream1/chunklist.m3u8", "PUT /live/stream1/chunklist.m3u8"}
+	if len(requests) != len(xpectedRequests) {
+		t.Fatalf("Number of requests is not correct, got %v, want %v", requests, xpectedRequests)
+	}
+	for i, xpectedRequest := range xpectedRequests {
+		if requests[i] != xpectedRequest {
+			t.Errorf("Request %d is not correct, got %s, want %s", i, requests[i], xpectedRequest)
+		}
+	}
+}
+
+func TestHlsWebDAVMkcolError(t *testing.T) {
+	requests := make([]string, 0)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "live/chunklist.m3u8", "", HlsOutputModeWebDAV, server.Client(), serverURL.Scheme, serverURL.Host)
+	h.SetWebDAVCreateParents(true)
+
+	if err := h.AddChunk(Chunk{FileName: "live/chunk_00000.ts", DurationS: 4.0}, true); err == nil {
+		t.Errorf("Expected an error creating the collection")
+	}
+
+	// The manifest is not uploaded if the collection could not be created
+	if len(requests) != 1 || requests[0] != "MKCOL /live/" {
+		t.Errorf("Requests are not correct, got %v, want [MKCOL /live/]", requests)
+	}
+}
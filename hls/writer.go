@@ -0,0 +1,40 @@
+package hls
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	// DefaultOutputWriterDelimiter Line written after each chunklist in writer output mode
+	DefaultOutputWriterDelimiter = "#----\n"
+)
+
+var (
+	// ErrOutputWriterNotSet Writer output mode is used without SetOutputWriter
+	ErrOutputWriterNotSet = errors.New("output writer not set")
+)
+
+// SetOutputWriter Sets the writer (ex: os.Stdout) that receives each published chunklist in HlsOutputModeWriter,
+// followed by the delimiter (DefaultOutputWriterDelimiter if empty)
+func (p *Hls) SetOutputWriter(outputWriter io.Writer, delimiter string) {
+	if delimiter == "" {
+		delimiter = DefaultOutputWriterDelimiter
+	}
+
+	p.outputWriter = outputWriter
+	p.outputWriterDelimiter = delimiter
+}
+
+func (p *Hls) saveManifestToWriter(fileName string, manifestByte []byte) error {
+	if p.outputWriter == nil {
+		return ErrOutputWriterNotSet
+	}
+
+	_, err := p.outputWriter.Write(append(append([]byte(nil), manifestByte...), p.outputWriterDelimiter...))
+	if err != nil {
+		p.log.Error("Error writing ", fileName, " to output writer. Error: ", err)
+	}
+
+	return err
+}
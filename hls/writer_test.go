@@ -0,0 +1,40 @@
+package hls
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestHlsOutputWriter(t *testing.T) {
+	var buf bytes.Buffer
+
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeWriter, nil, "", "")
+	h.SetOutputWriter(&buf, "")
+
+	xpectedStr := ""
+	for i := 0; i < 3; i++ {
+		if err := h.AddChunk(Chunk{FileName: fmt.Sprintf("results/chunk_%05d.ts", i), DurationS: 4.0}, true); err != nil {
+			t.Fatalf("Unexpected error publishing, got %v", err)
+		}
+		xpectedStr += h.String() + DefaultOutputWriterDelimiter
+	}
+
+	if buf.String() != xpectedStr {
+		t.Errorf("Written chunklists are not correct, got %s, want %s", buf.String(), xpectedStr)
+	}
+	if count := strings.Count(buf.String(), "#EXTM3U\n"); count != 3 {
+		t.Errorf("Number of chunklists is not correct, got %d, want %d", count, 3)
+	}
+}
+
+func TestHlsOutputWriterNotSet(t *testing.T) {
+	h := New(logrus.New(), LiveWindow, 3, false, 4.0, 3, "results/chunklist.m3u8", "", HlsOutputModeWriter, nil, "", "")
+
+	if err := h.AddChunk(Chunk{FileName: "results/chunk_00000.ts", DurationS: 4.0}, true); err != ErrOutputWriterNotSet {
+		t.Errorf("Error is not correct, got %v, want %v", err, ErrOutputWriterNotSet)
+	}
+}
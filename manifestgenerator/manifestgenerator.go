@@ -436,9 +436,9 @@ func (mg *ManifestGenerator) hlsClose() {
 	mg.hlsChunklist.CloseManifest(true)
 }
 
-func (mg *ManifestGenerator) hlsAddChunk(isGrowing bool, fileName string, durationS float64, isDisco bool) {
+func (mg *ManifestGenerator) hlsAddChunk(isGrowing bool, fileName string, durationS float64, isDisco bool, sizeBytes int64) {
 
-	err := mg.hlsChunklist.AddChunk(hls.Chunk{IsGrowing: isGrowing, FileName: fileName, DurationS: durationS, IsDisco: isDisco}, true)
+	err := mg.hlsChunklist.AddChunk(hls.Chunk{IsGrowing: isGrowing, FileName: fileName, DurationS: durationS, IsDisco: isDisco, SizeBytes: sizeBytes}, true)
 	if err != nil {
 		mg.options.log.Error("Error generating / saving the chunklists. Err: ", err)
 	}
@@ -455,7 +455,7 @@ func (mg *ManifestGenerator) closeChunk(isInit bool, chunkDurationS float64, isF
 
 			//NO LHLS
 			if mg.options.lhlsAdvancedChunks <= 0 {
-				mg.hlsAddChunk(false, currentChunk.GetFilename(), chunkDurationS, false)
+				mg.hlsAddChunk(false, currentChunk.GetFilename(), chunkDurationS, false, int64(currentChunk.GetTotalBytes()))
 				if mg.options.manifestType == hls.Vod {
 					if isFinalChunk {
 						mg.hlsClose()
@@ -549,7 +549,7 @@ func (mg *ManifestGenerator) createChunk(isInit bool) {
 
 			// Add the advanced chunk to the manifest with target dur
 			if mg.options.lhlsAdvancedChunks > 0 {
-				mg.hlsAddChunk(true, newChunk.GetFilename(), mg.options.targetSegmentDurS, false)
+				mg.hlsAddChunk(true, newChunk.GetFilename(), mg.options.targetSegmentDurS, false, 0)
 			}
 
 			mg.currentChunks = append(mg.currentChunks, newChunk)
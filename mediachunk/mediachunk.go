@@ -256,6 +256,11 @@ func (c *Chunk) IsEmpty() bool {
 	return ret
 }
 
+//GetTotalBytes Returns the number of bytes added to this chunk
+func (c *Chunk) GetTotalBytes() int {
+	return c.totalBytes
+}
+
 //GetFilename Add data to chunk and flush it
 func (c *Chunk) GetFilename() string {
 	return c.filename